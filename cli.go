@@ -2,25 +2,46 @@ package main
 
 import (
 	"bytes"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"text/tabwriter"
 	"text/template"
 	"time"
 
-	"github.com/influxdata/influxdb/client/v2"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
 )
 
 type App struct {
 	cfgFile string
+	sets    []string
 
 	cfg struct {
-		initOffset int
-		initDelete bool
+		initOffset    int
+		initDelete    bool
+		showSecrets   bool
+		showSources   bool
+		testUpdate    bool
+		input         string
+		saveResponse  string
+		format        string
+		poopFormat    string
+		output        string
+		from          string
+		to            string
+		groupBy       []string
+		dryRun        bool
+		note          string
+		warnLag       time.Duration
+		maxLag        time.Duration
+		statusTimeout time.Duration
+		report        string
 	}
 
 	log *zap.SugaredLogger
@@ -45,31 +66,155 @@ func NewApp() *App {
 		Short: "Feed data from ElasticSearch to InfluxDB",
 	}
 	rootCmd.PersistentFlags().StringVarP(&a.cfgFile, "cfg", "c", "$HOME/ruminant.yaml", "configuration file path")
+	rootCmd.PersistentFlags().StringArrayVar(&a.sets, "set", nil, "override a config key, eg. 'gulp.db=staging' (can be repeated)")
 	a.Execute = rootCmd.Execute
 
 	// init
 	initCmd := &cobra.Command{
 		Use:   "init",
 		Short: "Prepares the InfluxDB to be used with Ruminant",
-		Long: `Creates the InfluxDB as configured at sets an initial marker
-timestamp with a given offset in relation to the current time.`,
+		Long: `Creates the InfluxDB as configured along with the retention policy
+and continuous queries of the 'gulp' section and sets an initial marker
+timestamp with a given offset in relation to the current time. Running
+'init' again updates the database and keeps an existing marker unless
+'--delete' is passed.`,
 		Run: a.initCmd,
 	}
 	initCmd.PersistentFlags().IntVarP(&a.cfg.initOffset, "offset", "o", 24, "Offset of the initial timestamp in hours")
 	initCmd.PersistentFlags().BoolVarP(&a.cfg.initDelete, "delete", "d", false, "Delete existing timestamps")
+	initCmd.PersistentFlags().MarkDeprecated("offset", "use 'ruminant marker set' instead")
 	rootCmd.AddCommand(initCmd)
 
+	// marker
+	markerCmd := &cobra.Command{
+		Use:   "marker",
+		Short: "Inspect and move marker timestamps",
+		Long: `Reads, sets or deletes the marker timestamp of the configuration,
+which is where the next run starts. The query run is printed, with
+'--dry-run' the query is printed without running it.`,
+	}
+	markerCmd.PersistentFlags().BoolVar(&a.cfg.dryRun, "dry-run", false, "Print the query without running it")
+	markerCmd.AddCommand(&cobra.Command{
+		Use:   "get",
+		Short: "Print the latest marker of the configuration",
+		Args:  cobra.NoArgs,
+		Run:   a.markerGetCmd,
+	})
+	markerCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Print the latest marker of every indicator in the series",
+		Args:  cobra.NoArgs,
+		Run:   a.markerListCmd,
+	})
+	markerSetCmd := &cobra.Command{
+		Use:   "set TIME",
+		Short: "Move the marker to the time given",
+		Long: `Moves the marker of the configuration to the time given, either a
+date such as '2020-09-01 12:00' or relative such as '-24h' or 'startOfDay'.
+Markers newer than the time given are deleted.`,
+		Args: cobra.ExactArgs(1),
+		Run:  a.markerSetCmd,
+	}
+	markerSetCmd.Flags().StringVar(&a.cfg.note, "note", "set", "Note stored along with the marker")
+	markerCmd.AddCommand(markerSetCmd)
+	markerCmd.AddCommand(&cobra.Command{
+		Use:   "delete",
+		Short: "Delete all markers of the configuration",
+		Args:  cobra.NoArgs,
+		Run:   a.markerDeleteCmd,
+	})
+	rootCmd.AddCommand(markerCmd)
+
 	// config
 	configCmd := &cobra.Command{
 		Use:   "config",
 		Short: "Prints the config used to the stdout",
 		Long: `Prints the configuration used to standard output. If no configuration
 is passed in via '-c' the defaults are printed. This is useful either to bootstrap
-a new configuration or to debug an existig config file.`,
+a new configuration or to debug an existig config file. Secrets such as passwords
+are redacted unless '--show-secrets' is passed.`,
 		Run: a.configCmd,
 	}
+	configCmd.PersistentFlags().BoolVar(&a.cfg.showSecrets, "show-secrets", false, "Print secrets such as passwords instead of redacting them")
+	configCmd.PersistentFlags().BoolVar(&a.cfg.showSources, "sources", false, "Print every key along with the source of its value")
 	rootCmd.AddCommand(configCmd)
 
+	// validate
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration for errors",
+		Long: `Performs static checks on the configuration without connecting to
+ElasticSearch or InfluxDB. Unknown keys are reported as errors, all 'jee'
+expressions of the iterators are compiled, the sampler is checked and the
+query is rendered with a sample timestamp to make sure it is valid JSON. All
+problems found are reported along with their line in the configuration file.`,
+		Run: a.validateCmd,
+	}
+	rootCmd.AddCommand(validateCmd)
+
+	// schema
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print JSON Schemas",
+	}
+	schemaConfigCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Print the JSON Schema of the configuration file",
+		Long: `Prints a JSON Schema describing the configuration file, including
+descriptions, defaults and allowed values of all keys. Editors such as VS Code
+use it for autocompletion and validation, eg. via the 'yaml.schemas' setting.`,
+		Run: a.schemaConfigCmd,
+	}
+	schemaCmd.AddCommand(schemaConfigCmd)
+	rootCmd.AddCommand(schemaCmd)
+
+	// test
+	testCmd := &cobra.Command{
+		Use:   "test DIR",
+		Short: "Test iterators against captured responses",
+		Long: `Runs iterators against captured ElasticSearch responses without
+connecting to ElasticSearch or InfluxDB. Every subdirectory of DIR is a test
+case consisting of the following files:
+
+  response.json              the response captured, eg. via 'burp --save-response'
+  config.yaml/iterator.yaml  a full configuration or only an iterator
+  expected.yaml/expected.lp  the points expected as YAML or line protocol
+
+A diff is printed for every case that does not produce the points expected.
+'--update' rewrites the expected points with the actual ones.`,
+		Args: cobra.ExactArgs(1),
+		Run:  a.testCmd,
+	}
+	testCmd.PersistentFlags().BoolVar(&a.cfg.testUpdate, "update", false, "Rewrite the expected points with the actual ones")
+	rootCmd.AddCommand(testCmd)
+
+	// explore
+	exploreCmd := &cobra.Command{
+		Use:   "explore",
+		Short: "Explore a response interactively",
+		Long: `Loads a response, either by running the first query of the next run or
+from the file passed via '--input', and starts a shell to evaluate 'jee'
+expressions on it. Press tab to complete keys. The selectors used to enter
+iterators, along with the tags and values added, are printed as iterator
+configuration via ':yaml'.`,
+		Run: a.exploreCmd,
+	}
+	exploreCmd.PersistentFlags().StringVar(&a.cfg.input, "input", "", "Read the response from a file instead of querying ElasticSearch")
+	rootCmd.AddCommand(exploreCmd)
+
+	// scaffold
+	scaffoldCmd := &cobra.Command{
+		Use:   "scaffold",
+		Short: "Generate an iterator from the query",
+		Long: `Walks the aggregations of 'regurgitate.query' and prints an iterator
+matching the response expected. Bucket aggregations such as 'date_histogram',
+'terms' or 'histogram' become iterators providing the time or tags of the data
+points, metrics such as 'sum', 'avg' or 'percentiles' become values. The
+result is meant to be edited and pasted into the configuration.`,
+		Run: a.scaffoldCmd,
+	}
+	rootCmd.AddCommand(scaffoldCmd)
+
 	// burp
 	burpCmd := &cobra.Command{
 		Use:   "burp",
@@ -81,6 +226,9 @@ a new configuration or to debug an existig config file.`,
  or creating new ones.`,
 		Run: a.burpCmd,
 	}
+	burpCmd.PersistentFlags().StringVar(&a.cfg.input, "input", "", "Process a response read from a file ('-' for stdin) instead of querying ElasticSearch")
+	burpCmd.PersistentFlags().StringVar(&a.cfg.saveResponse, "save-response", "", "Save the responses of ElasticSearch to a file")
+	burpCmd.PersistentFlags().StringVar(&a.cfg.format, "format", FormatTable, "Output format: "+strings.Join(Formats, ", "))
 	rootCmd.AddCommand(burpCmd)
 
 	// vomit
@@ -91,16 +239,40 @@ a new configuration or to debug an existig config file.`,
 helpful for debugging reasons.`,
 		Run: a.vomitCmd,
 	}
+	vomitCmd.PersistentFlags().StringVar(&a.cfg.input, "input", "", "Process a response read from a file ('-' for stdin) instead of querying ElasticSearch")
+	vomitCmd.PersistentFlags().StringVar(&a.cfg.saveResponse, "save-response", "", "Save the responses of ElasticSearch to a file")
+	vomitCmd.PersistentFlags().StringVar(&a.cfg.format, "format", FormatTable, "Output format: "+strings.Join(Formats, ", "))
 	rootCmd.AddCommand(vomitCmd)
 
+	// status
+	statusCmd := &cobra.Command{
+		Use:   "status [CONFIG...]",
+		Short: "Check the lag of the marker and the databases",
+		Long: `Reports the marker of each configuration given, or of the one passed
+via '--cfg', its lag against the current time minus the sampler offset,
+the number of intervals pending and whether ElasticSearch and InfluxDB
+are reachable. The output and the exit code follow the conventions of
+Nagios plugins: 0 (OK), 1 (WARNING), 2 (CRITICAL) and 3 (UNKNOWN).`,
+		Run: a.statusCmd,
+	}
+	statusCmd.PersistentFlags().DurationVar(&a.cfg.warnLag, "warn-lag", 0, "Report a warning if the lag exceeds the duration given")
+	statusCmd.PersistentFlags().DurationVar(&a.cfg.maxLag, "max-lag", 0, "Report a critical state if the lag exceeds the duration given")
+	statusCmd.PersistentFlags().DurationVar(&a.cfg.statusTimeout, "timeout", DefaultStatusTimeout, "Time to wait for each database check of a configuration")
+	rootCmd.AddCommand(statusCmd)
+
 	// poop
 	poopCmd := &cobra.Command{
 		Use:   "poop",
 		Short: "Dump data from InfluxDB to stdout",
 		Long: `Dumps the content of the InfluxDB to the standard output as
-CSV file. The time range can be configured.`,
+CSV, TSV, JSON or newline delimited JSON. The time range can be configured.`,
 		Run: a.poopCmd,
 	}
+	poopCmd.PersistentFlags().StringVar(&a.cfg.poopFormat, "format", PoopCSV, "Output format: "+strings.Join(PoopFormats, ", "))
+	poopCmd.PersistentFlags().StringVarP(&a.cfg.output, "output", "o", "", "Write to a file instead of stdout")
+	poopCmd.PersistentFlags().StringVar(&a.cfg.from, "from", "", "Start of the time range, either a date or relative such as '-7d' or 'startOfWeek'")
+	poopCmd.PersistentFlags().StringVar(&a.cfg.to, "to", "", "End of the time range, either a date or relative such as 'now' or 'today'")
+	poopCmd.PersistentFlags().StringSliceVar(&a.cfg.groupBy, "group-by", nil, "Group by the tags given, each tag is written as column")
 	rootCmd.AddCommand(poopCmd)
 
 	// gulp
@@ -113,6 +285,7 @@ At the end of this process, this also writes a new marker timestamp
 to the InfluxDB.`,
 		Run: a.gulpCmd,
 	}
+	gulpCmd.PersistentFlags().StringVar(&a.cfg.report, "report", "", "Write a summary of the run as JSON to a file")
 	rootCmd.AddCommand(gulpCmd)
 
 	// version
@@ -127,178 +300,544 @@ to the InfluxDB.`,
 }
 
 func (a *App) vomitCmd(cmd *cobra.Command, args []string) {
-	c, err := NewConf(a.cfgFile, true)
+	c, err := NewConf(a.cfgFile, true, a.sets)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	points := Ruminate(c, false, a.log)
+	w, err := NewPointWriter(os.Stdout, a.cfg.format, c.Gulp.Series)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = a.ruminate(c, false, func(s Slice, points []Point) error {
+		return w.Write(points)
+	})
+	if err != nil {
+		a.log.Fatalw("Could not ruminate", "error", err.Error())
+	}
+	if err := w.Close(); err != nil {
+		a.log.Fatalw("Could not write points", "error", err.Error())
+	}
+}
 
-	a.log.Infof("Printing data points\n")
-	for _, p := range points {
-		fmt.Println(p)
+// ruminate runs the iterators either on the response read from '--input' or
+// on the responses of ElasticSearch.
+func (a *App) ruminate(c Config, burp bool, digest Digest) error {
+	if a.cfg.input != "" {
+		if a.cfg.saveResponse != "" {
+			return fmt.Errorf("'--save-response' can not be used along with '--input'")
+		}
+		return RuminateFile(c, a.cfg.input, burp, a.log, digest)
 	}
+	return Ruminate(c, RuminateOpts{Burp: burp, SaveResponse: a.cfg.saveResponse}, a.log, digest)
 }
 
 func (a *App) poopCmd(cmd *cobra.Command, args []string) {
-	c, err := NewConf(a.cfgFile, true)
+	c, err := NewConf(a.cfgFile, true, a.sets)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
+	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.RetentionPolicy.Name, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
 	if err != nil {
 		a.log.Fatalw("Could not create InfluxDB client", "error", err.Error())
 	}
 
-	t := template.Must(template.New("query").Parse(c.Poop.Query))
+	now := time.Now()
+	if a.cfg.from != "" {
+		from, err := ParseTimeExpr(a.cfg.from, now)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.Poop.Start = InfluxTime(from)
+	}
+	if a.cfg.to != "" {
+		to, err := ParseTimeExpr(a.cfg.to, now)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.Poop.End = InfluxTime(to)
+	}
+	if len(a.cfg.groupBy) > 0 {
+		c.Poop.GroupBy = a.cfg.groupBy
+	}
+
+	t, err := template.New("query").Parse(c.Poop.Query)
+	if err != nil {
+		log.Fatalf("poop query is not a valid template: %s", err.Error())
+	}
 
 	qd := struct {
-		Fields []string
-		Series string
-		Start  string
-		End    string
+		Fields          []string
+		Series          string
+		RetentionPolicy string
+		Start           string
+		End             string
+		GroupBy         []string
 	}{
-		Fields: c.Poop.Fields,
-		Series: c.Gulp.Series,
-		Start:  c.Poop.Start,
-		End:    c.Poop.End,
+		Fields:          c.Poop.Fields,
+		Series:          c.Gulp.Series,
+		RetentionPolicy: c.Gulp.RetentionPolicy.Name,
+		Start:           c.Poop.Start,
+		End:             c.Poop.End,
+		GroupBy:         c.Poop.GroupBy,
 	}
 
 	var query bytes.Buffer
-	t.Execute(&query, qd)
+	if err := t.Execute(&query, qd); err != nil {
+		log.Fatalf("poop query could not be rendered: %s", err.Error())
+	}
+
+	// the format is checked before querying, the output file is only created
+	// once the query succeeded so a failed query keeps an existing export
+	if _, err := NewRowWriter(ioutil.Discard, a.cfg.poopFormat, c.Poop); err != nil {
+		log.Fatal(err)
+	}
+
+	a.log.Infof("Query: %s", query.String())
 	res, err := i.Query(query.String())
 	if err != nil {
-		a.log.Infof("Query was: %s", query)
 		a.log.Fatalw("Could not query InfluxDB", "error", err.Error())
 	}
 
-	wr := csv.NewWriter(os.Stdout)
-	wr.Write(c.Poop.Fields)
-	wr.Flush()
-	for _, chunk := range res {
-		if len(chunk.Series) < 1 {
-			continue
+	out := os.Stdout
+	if a.cfg.output != "" {
+		if out, err = os.Create(a.cfg.output); err != nil {
+			a.log.Fatalw("Could not create output file", "error", err.Error())
 		}
-		for _, point := range chunk.Series[0].Values {
-			for i, elem := range point {
-				if i != 0 {
-					fmt.Printf(c.Poop.Separator)
-					switch elem := elem.(type) {
-					default:
-						if elem == nil {
-							fmt.Printf(c.Poop.ReplaceNil)
-						} else {
-							fmt.Printf("%v", elem)
-						}
-					case json.Number:
-						number, err := elem.Float64()
-						if err != nil {
-							fmt.Println(err)
-							break
-						}
-						fmt.Printf("%.0f", number)
-					}
-				} else {
-					ts, err := time.Parse("2006-01-02T15:04:05Z", elem.(string))
-					if err != nil {
-						fmt.Println(err)
-						break
-					}
-					fmt.Printf("%s", ts.Format(c.Poop.Format))
-				}
-			}
-			fmt.Printf("\n")
+	}
+	w, err := NewRowWriter(out, a.cfg.poopFormat, c.Poop)
+	if err == nil {
+		err = WriteResults(w, res, c.Poop.GroupBy, c.Poop.Fields)
+	}
+	if a.cfg.output != "" {
+		if cerr := out.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("could not close output file: %s", cerr.Error())
 		}
 	}
+	if err != nil {
+		a.log.Fatalw("Could not write data", "error", err.Error())
+	}
 }
 
 func (a *App) initCmd(cmd *cobra.Command, args []string) {
-	c, err := NewConf(a.cfgFile, true)
+	c, err := NewConf(a.cfgFile, true, a.sets)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	a.log.Infow("Going to create InfluxDB client")
-	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
+	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.RetentionPolicy.Name, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
 	if err != nil {
 		a.log.Fatal("Could net create InfluxDB client", "error", err.Error())
 	}
 
-	//a.log.Infof("Create InfluxDB %s", c.Gulp.Db)
-	//_, err = i.Query(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", c.Gulp.Db))
-	//if err != nil {
-	//	a.log.Fatal("Could not create database", "error", err.Error())
-	//}
+	a.log.Infof("Creating database %s", c.Gulp.Db)
+	if err := i.CreateDatabase(); err != nil {
+		a.log.Fatalw("Could not create database", "error", err.Error())
+	}
+	if rp := c.Gulp.RetentionPolicy; rp.Name != "" {
+		stmt, err := i.EnsureRetentionPolicy(rp)
+		if stmt == "" && err == nil {
+			a.log.Infof("Retention policy %s is up to date", rp.Name)
+		} else {
+			a.log.Infof("Retention policy: %s", stmt)
+		}
+		if err != nil {
+			a.log.Fatalw("Could not create retention policy", "error", err.Error())
+		}
+	}
+	for _, cq := range c.Gulp.ContinuousQueries {
+		stmts, err := i.EnsureContinuousQuery(cq)
+		if len(stmts) == 0 && err == nil {
+			a.log.Infof("Continuous query %s is up to date", cq.Name)
+		}
+		for _, stmt := range stmts {
+			a.log.Infof("Continuous query: %s", stmt)
+		}
+		if err != nil {
+			a.log.Fatalw("Could not create continuous query", "error", err.Error())
+		}
+	}
+
 	if a.cfg.initDelete {
 		a.log.Infow("Deleting existing timestamps")
-		i.DeleteLatestMarker()
+		if err := i.DeleteLatestMarker(); err != nil {
+			a.log.Fatalw("Could not delete timestamps", "error", err.Error())
+		}
+	} else if latest, err := i.GetMarker(); err == nil {
+		// running init again only updates the database, the progress is kept
+		migrated, err := i.MigrateMarker(latest)
 		if err != nil {
-			a.log.Fatal("Could not create database", "error", err.Error())
+			a.log.Fatalw("Could not migrate timestamp", "error", err.Error())
 		}
+		if migrated {
+			a.log.Infof("Copied existing timestamp to retention policy %s", i.RetentionPolicy)
+		}
+		a.log.Infof("Keeping existing timestamp at %s, use '--delete' to reset it", latest.Time.Format("2006-01-02 15:04:05"))
+		return
+	} else if _, ok := err.(noMarkerError); !ok {
+		// writing a marker deletes the existing ones, so it must not be
+		// written if they could not be read
+		a.log.Fatalw("Could not read timestamp", "error", err.Error())
 	}
 
 	a.log.Infof("Creating initial timestamp with an offset of %d hours", a.cfg.initOffset)
-	bp, err := client.NewBatchPoints(client.BatchPointsConfig{Database: i.DB, Precision: "s"})
+	timestamp := time.Now().Add(-(time.Hour * time.Duration(a.cfg.initOffset)))
+	if err := i.SetMarker(timestamp, "init"); err != nil {
+		a.log.Fatalw("Could not save initial timestamp", "error", err.Error())
+	}
+}
+
+// markerInflux returns the InfluxDB client of the configuration.
+func (a *App) markerInflux() Influx {
+	c, err := NewConf(a.cfgFile, true, a.sets)
+	if err != nil {
+		log.Fatal(err)
+	}
+	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.RetentionPolicy.Name, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
 	if err != nil {
-		a.log.Fatal("Could create initial timestamp", "error", err.Error())
+		a.log.Fatalw("Could not create InfluxDB client", "error", err.Error())
 	}
+	return i
+}
 
-	timestamp := time.Now().Add(-(time.Hour * time.Duration(a.cfg.initOffset)))
-	bp.AddPoint(i.LatestMarker(timestamp, "init"))
+// printQuery prints the query to be run. It returns false if the query must
+// not be run.
+func (a *App) printQuery(q string) bool {
+	if a.cfg.dryRun {
+		fmt.Println(q)
+		return false
+	}
+	a.log.Infof("Query: %s", q)
+	return true
+}
+
+func (a *App) markerGetCmd(cmd *cobra.Command, args []string) {
+	i := a.markerInflux()
+	if !a.printQuery(i.MarkerQuery()) {
+		return
+	}
+	m, err := i.GetMarker()
+	if err != nil {
+		a.log.Fatalw("Could not get marker", "error", err.Error())
+	}
+	printMarkers(os.Stdout, []Marker{m})
+}
 
-	if err := i.Client.Write(bp); err != nil {
-		a.log.Fatal("Could save initial timestamp", "error", err.Error())
+func (a *App) markerListCmd(cmd *cobra.Command, args []string) {
+	i := a.markerInflux()
+	if !a.printQuery(i.ListMarkersQuery()) {
+		return
+	}
+	markers, err := i.ListMarkers()
+	if err != nil {
+		a.log.Fatalw("Could not list markers", "error", err.Error())
 	}
+	printMarkers(os.Stdout, markers)
 }
 
-func (a *App) burpCmd(cmd *cobra.Command, args []string) {
-	c, err := NewConf(a.cfgFile, true)
+func (a *App) markerSetCmd(cmd *cobra.Command, args []string) {
+	i := a.markerInflux()
+	t, err := ParseTimeExpr(args[0], time.Now())
 	if err != nil {
 		log.Fatal(err)
 	}
+	t = t.Truncate(time.Second)
+	run := a.printQuery(i.DeleteMarkersQuery(t))
+	run = a.printQuery(i.MarkerWrite(t, a.cfg.note)) && run
+	if !run {
+		return
+	}
+	if err := i.SetMarker(t, a.cfg.note); err != nil {
+		a.log.Fatalw("Could not set marker", "error", err.Error())
+	}
+	a.log.Infof("Marker of '%s' set to %s", i.Indicator, t.UTC().Format(time.RFC3339))
+}
+
+func (a *App) markerDeleteCmd(cmd *cobra.Command, args []string) {
+	i := a.markerInflux()
+	if !a.printQuery(i.DeleteMarkersQuery(time.Time{})) {
+		return
+	}
+	if err := i.DeleteLatestMarker(); err != nil {
+		a.log.Fatalw("Could not delete markers", "error", err.Error())
+	}
+	a.log.Infof("Markers of '%s' deleted", i.Indicator)
+}
+
+func printMarkers(out io.Writer, markers []Marker) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDICATOR\tTIME\tNOTE")
+	for _, m := range markers {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m.Indicator, m.Time.UTC().Format(time.RFC3339), m.Note)
+	}
+	w.Flush()
+}
+
+func (a *App) statusCmd(cmd *cobra.Command, args []string) {
+	files := args
+	if len(files) < 1 {
+		files = []string{a.cfgFile}
+	}
+
+	now := time.Now()
+	state := NagiosOK
+	var statuses []Status
+	var messages [NagiosUnknown + 1][]string
+	for _, file := range files {
+		var s Status
+		c, err := NewConf(file, true, a.sets)
+		if err != nil {
+			s = Status{Name: file, Err: err}
+		} else {
+			s = GetStatus(file, c, now, a.cfg.statusTimeout)
+		}
+		st, msg := s.Check(a.cfg.warnLag, a.cfg.maxLag)
+		if st > state {
+			state = st
+		}
+		messages[st] = append(messages[st], msg)
+		statuses = append(statuses, s)
+	}
+
+	var perf []string
+	for _, s := range statuses {
+		if s.Err == nil {
+			perf = append(perf, s.Perfdata(a.cfg.warnLag, a.cfg.maxLag))
+		}
+	}
+	fmt.Printf("RUMINANT %s - %s | %s\n", nagiosStates[state], strings.Join(messages[state], ", "), strings.Join(perf, " "))
+	for _, s := range statuses {
+		fmt.Println(s)
+	}
+	os.Exit(state)
+}
 
-	points := Ruminate(c, true, a.log)
+func (a *App) burpCmd(cmd *cobra.Command, args []string) {
+	c, err := NewConf(a.cfgFile, true, a.sets)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	a.log.Infof("Printing sample data point\n")
-	for _, p := range points {
-		fmt.Println(p)
+	w, err := NewPointWriter(os.Stdout, a.cfg.format, c.Gulp.Series)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = a.ruminate(c, true, func(s Slice, points []Point) error {
+		if len(points) < 1 {
+			return nil
+		}
+		a.log.Infof("Printing sample data point\n")
+		if err := w.Write(points); err != nil {
+			return err
+		}
+		return errStop
+	})
+	if err != nil {
+		a.log.Fatalw("Could not ruminate", "error", err.Error())
+	}
+	if err := w.Close(); err != nil {
+		a.log.Fatalw("Could not write points", "error", err.Error())
 	}
 }
 
 func (a *App) configCmd(cmd *cobra.Command, args []string) {
-	c, err := NewConf(a.cfgFile, false)
+	c, err := NewConf(a.cfgFile, false, a.sets)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if !a.cfg.showSecrets {
+		c = c.Redacted()
+	}
+	if a.cfg.showSources {
+		fmt.Print(c.Sources())
+		return
+	}
 	fmt.Println(c)
 }
 
-func (a *App) gulpCmd(cmd *cobra.Command, args []string) {
-	c, err := NewConf(a.cfgFile, true)
+func (a *App) validateCmd(cmd *cobra.Command, args []string) {
+	problems := Validate(a.cfgFile, a.sets)
+	if len(problems) < 1 {
+		fmt.Printf("%s is valid\n", a.cfgFile)
+		return
+	}
+	for _, p := range problems {
+		fmt.Printf("%s: %s\n", a.cfgFile, p)
+	}
+	os.Exit(1)
+}
+
+func (a *App) schemaConfigCmd(cmd *cobra.Command, args []string) {
+	s, err := ConfigSchema()
+	if err != nil {
+		a.log.Fatalw("Could not generate schema", "error", err.Error())
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		a.log.Fatalw("Could not generate schema", "error", err.Error())
+	}
+	fmt.Println(string(b))
+}
+
+func (a *App) testCmd(cmd *cobra.Command, args []string) {
+	cases, err := FindTestCases(args[0])
+	if err != nil {
+		a.log.Fatalw("Could not load test cases", "error", err.Error())
+	}
+
+	failed := 0
+	for _, tc := range cases {
+		actual, err := tc.Run()
+		if err != nil {
+			fmt.Printf("FAIL %s: %s\n", tc.Name, err.Error())
+			failed++
+			continue
+		}
+		if a.cfg.testUpdate {
+			if err := tc.Update(actual); err != nil {
+				a.log.Fatalw("Could not update expected points", "case", tc.Name, "error", err.Error())
+			}
+			fmt.Printf("updated %s (%d points)\n", tc.Name, len(actual))
+			continue
+		}
+		expected, err := tc.Expected()
+		if err != nil {
+			fmt.Printf("FAIL %s: could not read expected points: %s\n", tc.Name, err.Error())
+			failed++
+			continue
+		}
+		if diff := tc.Compare(expected, actual); diff != "" {
+			fmt.Printf("FAIL %s\n--- expected\n+++ actual\n%s", tc.Name, diff)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s (%d points)\n", tc.Name, len(actual))
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d test cases failed\n", failed, len(cases))
+		os.Exit(1)
+	}
+}
+
+func (a *App) exploreCmd(cmd *cobra.Command, args []string) {
+	c, err := NewConf(a.cfgFile, a.cfg.input == "", a.sets)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	points := Ruminate(c, false, a.log)
+	var r EsResponse
+	if a.cfg.input == "" {
+		r, err = FetchResponse(c, a.log)
+	} else {
+		var f *os.File
+		if f, err = openInput(a.cfg.input); err == nil {
+			r, err = NewEsResponse(f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		a.log.Fatalw("Could not load response", "error", err.Error())
+	}
+	doc, err := r.Root(c.Ruminate.Root)
+	if err != nil {
+		a.log.Fatalw("Could not load response", "error", err.Error())
+	}
+
+	e, err := NewExplorer(doc, os.Stdout)
+	if err != nil {
+		a.log.Fatalw("Could not load response", "error", err.Error())
+	}
+	if err := e.Run(NewLineReader()); err != nil {
+		a.log.Fatalw("Could not read input", "error", err.Error())
+	}
+}
+
+func (a *App) scaffoldCmd(cmd *cobra.Command, args []string) {
+	c, err := NewConf(a.cfgFile, true, a.sets)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	qt, err := NewQueryTemplate(c)
+	if err != nil {
+		a.log.Fatalw("Could not render query", "error", err.Error())
+	}
+	q, err := qt.RenderSample(c.Regurgitate.Sampler)
+	if err != nil {
+		a.log.Fatalw("Could not render query", "error", err.Error())
+	}
+	i, warnings, err := Scaffold([]byte(q.Body), c.Ruminate.Root)
+	if err != nil {
+		a.log.Fatalw("Could not scaffold iterator", "error", err.Error())
+	}
+
+	b, err := yaml.Marshal(map[string]interface{}{"ruminate": map[string]interface{}{"iterator": i}})
+	if err != nil {
+		a.log.Fatalw("Could not scaffold iterator", "error", err.Error())
+	}
+	for _, w := range warnings {
+		fmt.Printf("# %s\n", w)
+	}
+	fmt.Print(string(b))
+}
+
+func (a *App) gulpCmd(cmd *cobra.Command, args []string) {
+	c, err := NewConf(a.cfgFile, true, a.sets)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	a.log.Infow("Going to create InfluxDB client")
-	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
+	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.RetentionPolicy.Name, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
 	if err != nil {
 		a.log.Fatalw("Could not create InfluxDB client", "error", err.Error())
 	}
 
-	if len(points) < 1 {
-		a.log.Infow("No data points to save")
-		os.Exit(0)
+	report := RunReport{Indicator: c.Gulp.Indicator, Start: time.Now()}
+	err = Ruminate(c, RuminateOpts{Report: &report}, a.log, func(s Slice, points []Point) error {
+		if len(points) < 1 && s.Marker.IsZero() {
+			a.log.Infow("No data points to save")
+			return nil
+		}
+		a.log.Infof("Saving %d data points to InfluxDB", len(points))
+		res, err := i.Write(points, s.Marker)
+		if err != nil {
+			report.PointsDropped += len(points)
+			return fmt.Errorf("could not write data to InfluxDB: %s", err.Error())
+		}
+		report.PointsWritten += res.Written
+		report.MarkerAfter = res.Marker
+		return nil
+	})
+	report.End = time.Now()
+	if report.MarkerAfter.IsZero() {
+		report.MarkerAfter = report.MarkerBefore
 	}
-	a.log.Infof("Saving %d data points to InfluxDB", len(points))
-	err = i.Write(points)
 	if err != nil {
-		a.log.Fatalw("Could not write data to InfluxDB", "error", err.Error())
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	if a.cfg.report != "" {
+		a.log.Infof("Saving report to %s", a.cfg.report)
+		if err := report.Save(a.cfg.report); err != nil {
+			a.log.Infow("Could not save report", "error", err.Error())
+		}
+	}
+	if c.Gulp.RunSeries != "" {
+		a.log.Infof("Writing report to series %s", c.Gulp.RunSeries)
+		if err := i.WriteReport(report, c.Gulp.RunSeries); err != nil {
+			a.log.Infow("Could not write report to InfluxDB", "error", err.Error())
+		}
+	}
+
+	if err != nil {
+		a.log.Fatalw("Could not ruminate", "error", err.Error())
 	}
-	a.log.Infow("Data points saved")
+	a.log.Infof("%d data points saved", report.PointsWritten)
 }
 
 func (a *App) versionCmd(cmd *cobra.Command, args []string) {
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/robfig/cron.v2"
+)
+
+// cronField holds the bounds and names of a field of a cron spec.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{"second", 0, 59, nil},
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{"day of week", 0, 6, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+var cronDescriptors = []string{"@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly"}
+
+// ParseCron parses a cron spec such as '0 */5 * * * *' or '@every 1h'. The
+// spec is checked before it is passed to the cron parser, which logs errors
+// instead of only returning them and loops forever on a step of zero.
+func ParseCron(spec string) (cron.Schedule, error) {
+	if err := checkCron(spec); err != nil {
+		return nil, err
+	}
+	return cron.Parse(spec)
+}
+
+func checkCron(spec string) error {
+	if strings.HasPrefix(spec, "TZ=") {
+		i := strings.Index(spec, " ")
+		if i < 0 {
+			return fmt.Errorf("expected a schedule after the timezone: %s", spec)
+		}
+		if _, err := time.LoadLocation(spec[3:i]); err != nil {
+			return fmt.Errorf("bad timezone %s: %s", spec[3:i], err.Error())
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		for _, d := range cronDescriptors {
+			if spec == d {
+				return nil
+			}
+		}
+		if strings.HasPrefix(spec, "@every ") {
+			if _, err := time.ParseDuration(spec[len("@every "):]); err != nil {
+				return fmt.Errorf("bad duration in %s: %s", spec, err.Error())
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown descriptor %s", spec)
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 && len(fields) != 6 {
+		return fmt.Errorf("expected 5 or 6 fields, found %d: %s", len(fields), spec)
+	}
+	if len(fields) == 5 {
+		fields = append([]string{"0"}, fields...)
+	}
+	for n, field := range fields {
+		for _, expr := range strings.FieldsFunc(field, func(r rune) bool { return r == ',' }) {
+			if err := cronFields[n].check(expr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// check checks a range of the field, ie. '*', 'n', 'n-m' optionally
+// followed by '/step'.
+func (f cronField) check(expr string) error {
+	rangeAndStep := strings.Split(expr, "/")
+	if len(rangeAndStep) > 2 {
+		return fmt.Errorf("too many slashes in %s: %s", f.name, expr)
+	}
+	if len(rangeAndStep) == 2 {
+		step, err := strconv.Atoi(rangeAndStep[1])
+		if err != nil || step < 1 {
+			return fmt.Errorf("step of %s must be a positive number: %s", f.name, expr)
+		}
+	}
+
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if len(lowAndHigh) > 1 {
+			return fmt.Errorf("unexpected range after wildcard in %s: %s", f.name, expr)
+		}
+		return nil
+	}
+	if len(lowAndHigh) > 2 {
+		return fmt.Errorf("too many hyphens in %s: %s", f.name, expr)
+	}
+	start, err := f.value(lowAndHigh[0])
+	if err != nil {
+		return err
+	}
+	end := start
+	if len(lowAndHigh) == 2 {
+		if end, err = f.value(lowAndHigh[1]); err != nil {
+			return err
+		}
+	}
+	if start > end {
+		return fmt.Errorf("beginning of range (%d) beyond end of range (%d) in %s: %s", start, end, f.name, expr)
+	}
+	return nil
+}
+
+// value parses a number or name of the field and checks its bounds.
+func (f cronField) value(s string) (int, error) {
+	for n, name := range f.names {
+		if strings.ToLower(s) == name {
+			return f.min + n, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s must be between %d and %d, got %d", f.name, f.min, f.max, v)
+	}
+	return v, nil
+}
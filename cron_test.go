@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"0 0 * * * *", ""},
+		{"0 */5 * * *", ""},
+		{"0 0 8-18/2 * * mon-fri", ""},
+		{"0 0 0 1 JAN,jul ?", ""},
+		{"5/15 * * * * *", ""},
+		{"@hourly", ""},
+		{"@every 1h30m", ""},
+		{"TZ=Europe/Berlin 0 0 * * * *", ""},
+		{"0 0 * * *  *  *", "expected 5 or 6 fields, found 7"},
+		{"* * *", "expected 5 or 6 fields, found 3"},
+		{"0 60 * * * *", "minute must be between 0 and 59, got 60"},
+		{"0 0 0 0 * *", "day of month must be between 1 and 31, got 0"},
+		{"0 0 * * foo *", "invalid month foo"},
+		{"0 0 18-8 * * *", "beginning of range (18) beyond end of range (8) in hour"},
+		{"0 0 1-2-3 * * *", "too many hyphens in hour"},
+		{"0 */0 * * * *", "step of minute must be a positive number"},
+		{"0 1/2/3 * * * *", "too many slashes in minute"},
+		{"0 *-5 * * * *", "unexpected range after wildcard in minute"},
+		{"@often", "unknown descriptor @often"},
+		{"@every often", "bad duration in @every often"},
+		{"TZ=Nowhere/Else 0 0 * * * *", "bad timezone Nowhere/Else"},
+		{"TZ=UTC", "expected a schedule after the timezone"},
+	}
+	for _, test := range tests {
+		s, err := ParseCron(test.spec)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %s", test.spec, err.Error())
+			} else if s.Next(time.Now()).IsZero() {
+				t.Errorf("%s: schedule never fires", test.spec)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error '%s', got %v", test.spec, test.err, err)
+		}
+	}
+}
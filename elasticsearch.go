@@ -3,10 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -19,30 +21,77 @@ type EsResponse struct {
 		Failed  float64 `json:"failed"`
 	} `json:"_shards"`
 	Hits struct {
-		Total    float64     `json:"total"`
+		Total    EsTotal     `json:"total"`
 		MaxScore float64     `json:"max_score"`
 		Hits     interface{} `json:"hits"`
 	} `json:"hits"`
 	Aggregations interface{} `json:"aggregations"`
-	Error        string      `json:"error"`
+	ScrollId     string      `json:"_scroll_id,omitempty"`
+	Error        string      `json:"error,omitempty"`
+}
+
+// EsTotal holds the total number of hits. ElasticSearch prior to version 7
+// returns a plain number while newer versions return an object containing
+// the 'value' and its 'relation'. Both forms are accepted, the total is
+// always written as plain number.
+type EsTotal struct {
+	Value    float64
+	Relation string
+}
+
+func (t *EsTotal) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &t.Value); err == nil {
+		t.Relation = "eq"
+		return nil
+	}
+	var total struct {
+		Value    float64 `json:"value"`
+		Relation string  `json:"relation"`
+	}
+	if err := json.Unmarshal(b, &total); err != nil {
+		return fmt.Errorf("could not read hits total: %s", err.Error())
+	}
+	t.Value = total.Value
+	t.Relation = total.Relation
+	return nil
+}
+
+func (t EsTotal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Value)
+}
+
+type EsErrorCause struct {
+	Type     string        `json:"type"`
+	Reason   string        `json:"reason"`
+	Line     int           `json:"line"`
+	Col      int           `json:"col"`
+	CausedBy *EsErrorCause `json:"caused_by"`
 }
 
 type EsError struct {
 	Error struct {
-		RootCause []struct {
-			Type   string `json:"type"`
-			Reason string `json:"reason"`
-			Line   int    `json:"line"`
-			Col    int    `json:"col"`
-		} `json:"root_cause"`
-		Type   string `json:"type"`
-		Reason string `json:"reason"`
-		Line   int    `json:"line"`
-		Col    int    `json:"col"`
+		EsErrorCause
+		RootCause []EsErrorCause `json:"root_cause"`
 	} `json:"error"`
 	Status int `json:"status"`
 }
 
+// Message builds a human readable error message from the error returned by
+// ElasticSearch. The 'line' is only reported by some versions of
+// ElasticSearch, 'caused_by' only by newer ones.
+func (e EsError) Message() string {
+	cause := e.Error.EsErrorCause
+	msg := fmt.Sprintf("elasticsearch error '%s'", cause.Type)
+	if cause.Line > 0 {
+		msg = fmt.Sprintf("%s occurred on line %d", msg, cause.Line)
+	}
+	msg = fmt.Sprintf("%s: %s", msg, cause.Reason)
+	for c := cause.CausedBy; c != nil; c = c.CausedBy {
+		msg = fmt.Sprintf("%s, caused by '%s': %s", msg, c.Type, c.Reason)
+	}
+	return msg
+}
+
 func NewEsResponse(in io.Reader) (EsResponse, error) {
 	var response EsResponse
 	body, err := ioutil.ReadAll(in)
@@ -53,55 +102,202 @@ func NewEsResponse(in io.Reader) (EsResponse, error) {
 	if err != nil {
 		var eserror EsError
 		nastyerr := json.Unmarshal(body, &eserror)
-		if nastyerr != nil {
+		if nastyerr != nil || eserror.Error.Type == "" {
 			return response, fmt.Errorf("could not unmarshal response: %s. Error was %s", string(body), err.Error())
 		}
-		return response, fmt.Errorf("elasticsearch error '%s' occurred on line %d: %s", eserror.Error.Type, eserror.Error.Line, eserror.Error.Reason)
+		return response, errors.New(eserror.Message())
 	}
 	return response, nil
 }
 
+type EsInfo struct {
+	Version struct {
+		Number       string `json:"number"`
+		Distribution string `json:"distribution"`
+	} `json:"version"`
+}
+
+// Major returns the major version number of the cluster.
+func (i EsInfo) Major() int {
+	var major int
+	fmt.Sscanf(i.Version.Number, "%d", &major)
+	return major
+}
+
+// Typeless indicates whether the cluster has mapping types removed, which is
+// the case for ElasticSearch 7 and newer as well as all versions of OpenSearch.
+func (i EsInfo) Typeless() bool {
+	return i.Version.Distribution == "opensearch" || i.Major() >= 7
+}
+
+func (i EsInfo) String() string {
+	if i.Version.Distribution == "opensearch" {
+		return fmt.Sprintf("OpenSearch %s", i.Version.Number)
+	}
+	return fmt.Sprintf("ElasticSearch %s", i.Version.Number)
+}
+
 func (esr EsResponse) AggsAsJson() ([]byte, error) {
 	return json.Marshal(esr.Aggregations)
 }
 
+// AsJson returns the whole response including 'hits', 'aggregations',
+// 'took' etc.
+func (esr EsResponse) AsJson() ([]byte, error) {
+	return json.Marshal(esr)
+}
+
+// Root returns the part of the response the iterators start at, either the
+// aggregations or the whole response.
+func (esr EsResponse) Root(root string) ([]byte, error) {
+	if root == RootResponse {
+		return esr.AsJson()
+	}
+	return esr.AggsAsJson()
+}
+
+const (
+	PagingNone        = ""
+	PagingSearchAfter = "search_after"
+	PagingScroll      = "scroll"
+
+	scrollKeepAlive = "1m"
+)
+
 type ElasticSearch struct {
-	Proto string
-	Host  string
-	Port  int
+	nodes             *NodePool
+	Typeless          bool
+	IgnoreUnavailable bool
 }
 
-func NewElasticSearch(proto, host string, port int) ElasticSearch {
+// NewElasticSearch creates an ElasticSearch client that spreads its requests
+// across the node URLs passed, eg. 'http://elastic.example.com:9200'.
+// Requests time out after DefaultEsTimeout.
+func NewElasticSearch(nodes []string) ElasticSearch {
+	return NewElasticSearchTimeout(nodes, DefaultEsTimeout)
+}
+
+// NewElasticSearchTimeout creates an ElasticSearch client like
+// NewElasticSearch. A request taking longer than 'timeout' is retried on the
+// next node, a zero timeout disables this.
+func NewElasticSearchTimeout(nodes []string, timeout time.Duration) ElasticSearch {
 	return ElasticSearch{
-		Proto: proto,
-		Host:  host,
-		Port:  port,
+		nodes: NewNodePool(nodes, timeout),
+	}
+}
+
+// Detect queries the version of the cluster and adapts the URLs used to the
+// version found.
+func (es *ElasticSearch) Detect() (EsInfo, error) {
+	var info EsInfo
+	status, body, err := es.nodes.Do("GET", "/", "")
+	if err != nil {
+		return info, err
+	}
+	if status < 200 || status > 299 {
+		return info, fmt.Errorf("could not detect version, status code %d, output %s", status, string(body))
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return info, fmt.Errorf("could not detect version: %s", err.Error())
 	}
+
+	es.Typeless = info.Typeless()
+	return info, nil
+}
+
+// Sniff replaces the nodes known with the nodes of the cluster that have
+// HTTP enabled.
+func (es ElasticSearch) Sniff() ([]string, error) {
+	status, body, err := es.nodes.Do("GET", "/_nodes/http", "")
+	if err != nil {
+		return nil, err
+	}
+	if status < 200 || status > 299 {
+		return nil, fmt.Errorf("could not sniff nodes, status code %d, output %s", status, string(body))
+	}
+
+	var res struct {
+		Nodes map[string]struct {
+			Http struct {
+				PublishAddress string `json:"publish_address"`
+			} `json:"http"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("could not sniff nodes: %s", err.Error())
+	}
+
+	var addrs []string
+	for _, node := range res.Nodes {
+		addr := node.Http.PublishAddress
+		if addr == "" {
+			continue
+		}
+		// newer versions publish the address as 'hostname/ip:port'
+		if i := strings.LastIndex(addr, "/"); i >= 0 {
+			addr = addr[i+1:]
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) < 1 {
+		return nil, fmt.Errorf("no nodes with http enabled found")
+	}
+	sort.Strings(addrs)
+
+	return es.nodes.Replace(addrs), nil
+}
+
+func (es ElasticSearch) searchPath(index, kind string) string {
+	path := fmt.Sprintf("/%s/%s/_search?pretty", index, kind)
+	if es.Typeless || kind == "" {
+		path = fmt.Sprintf("/%s/_search?pretty", index)
+	}
+	if es.IgnoreUnavailable {
+		path += "&ignore_unavailable=true"
+	}
+	return path
 }
 
 func (es ElasticSearch) Query(index, kind, jsonQuery string) (EsResponse, error) {
-	var esr EsResponse
-	url := fmt.Sprintf("%s://%s:%d/%s/%s/_search?pretty", es.Proto, es.Host, es.Port, index, kind)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(jsonQuery)))
+	return es.request("POST", es.searchPath(index, kind), jsonQuery)
+}
+
+func (es ElasticSearch) scroll(index, kind, jsonQuery string) (EsResponse, error) {
+	path := fmt.Sprintf("%s&scroll=%s", es.searchPath(index, kind), scrollKeepAlive)
+	return es.request("POST", path, jsonQuery)
+}
+
+func (es ElasticSearch) nextScroll(scrollId string) (EsResponse, error) {
+	body, err := json.Marshal(map[string]string{"scroll": scrollKeepAlive, "scroll_id": scrollId})
 	if err != nil {
-		return esr, err
+		return EsResponse{}, err
+	}
+	return es.request("POST", "/_search/scroll?pretty", string(body))
+}
+
+func (es ElasticSearch) clearScroll(scrollId string) error {
+	body, err := json.Marshal(map[string]string{"scroll_id": scrollId})
+	if err != nil {
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	_, _, err = es.nodes.Do("DELETE", "/_search/scroll", string(body))
+	return err
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (es ElasticSearch) request(method, path, body string) (EsResponse, error) {
+	var esr EsResponse
+	status, resp, err := es.nodes.Do(method, path, body)
 	if err != nil {
 		return esr, err
 	}
-	defer resp.Body.Close()
 
-	esr, err = NewEsResponse(resp.Body)
+	esr, err = NewEsResponse(bytes.NewReader(resp))
 	if err != nil {
 		return esr, err
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return esr, fmt.Errorf("error while executing query, status code %d, output %s", resp.StatusCode, esr.Error)
+	if status < 200 || status > 299 {
+		return esr, fmt.Errorf("error while executing query, status code %d, output %s", status, esr.Error)
 	}
 
 	if esr.Shards.Failed > 0 {
@@ -111,6 +307,179 @@ func (es ElasticSearch) Query(index, kind, jsonQuery string) (EsResponse, error)
 	return esr, nil
 }
 
+// QueryAll executes the query like Query does. If the query contains
+// 'composite' aggregations, the query is re-issued with the 'after' key
+// set to the 'after_key' returned until all pages are fetched. The buckets
+// of all pages are concatenated in the response returned. Search hits are
+// paged through in the same manner if 'paging' is either 'search_after'
+// or 'scroll'.
+func (es ElasticSearch) QueryAll(index, kind, jsonQuery, paging string) (EsResponse, error) {
+	var q map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonQuery), &q); err != nil {
+		return EsResponse{}, fmt.Errorf("could not parse query: %s", err.Error())
+	}
+
+	var esr EsResponse
+	var err error
+	switch paging {
+	case PagingNone:
+		esr, err = es.Query(index, kind, jsonQuery)
+	case PagingSearchAfter:
+		esr, err = es.searchAfter(index, kind, q)
+	case PagingScroll:
+		esr, err = es.scrollAll(index, kind, jsonQuery)
+	default:
+		err = fmt.Errorf("paging '%s' is not supported", paging)
+	}
+	if err != nil {
+		return esr, err
+	}
+
+	aggsKey, composites := compositeAggs(q)
+	if len(composites) < 1 {
+		return esr, nil
+	}
+
+	aggs, ok := esr.Aggregations.(map[string]interface{})
+	if !ok {
+		return esr, nil
+	}
+
+	for name, def := range composites {
+		agg, ok := aggs[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		buckets, _ := agg["buckets"].([]interface{})
+		afterKey, hasMore := agg["after_key"]
+		page := len(buckets)
+		for hasMore && page > 0 {
+			def["composite"].(map[string]interface{})["after"] = afterKey
+			q[aggsKey] = map[string]interface{}{name: def}
+			delete(q, "search_after")
+			body, err := json.Marshal(q)
+			if err != nil {
+				return esr, err
+			}
+			next, err := es.Query(index, kind, string(body))
+			if err != nil {
+				return esr, err
+			}
+			nextAggs, _ := next.Aggregations.(map[string]interface{})
+			nextAgg, _ := nextAggs[name].(map[string]interface{})
+			nextBuckets, _ := nextAgg["buckets"].([]interface{})
+			buckets = append(buckets, nextBuckets...)
+			afterKey, hasMore = nextAgg["after_key"]
+			page = len(nextBuckets)
+		}
+		agg["buckets"] = buckets
+		delete(agg, "after_key")
+	}
+
+	return esr, nil
+}
+
+// searchAfter pages through the search hits by setting 'search_after' to the
+// sort values of the last hit of the previous page. The query must therefore
+// define a 'sort'.
+func (es ElasticSearch) searchAfter(index, kind string, q map[string]interface{}) (EsResponse, error) {
+	body, err := json.Marshal(q)
+	if err != nil {
+		return EsResponse{}, err
+	}
+	esr, err := es.Query(index, kind, string(body))
+	if err != nil {
+		return esr, err
+	}
+
+	hits, _ := esr.Hits.Hits.([]interface{})
+	page := hits
+	for len(page) > 0 {
+		last, _ := page[len(page)-1].(map[string]interface{})
+		sort, ok := last["sort"]
+		if !ok {
+			return esr, fmt.Errorf("hits do not contain sort values, 'search_after' requires a 'sort' in the query")
+		}
+
+		next := make(map[string]interface{})
+		for k, v := range q {
+			next[k] = v
+		}
+		delete(next, "aggs")
+		delete(next, "aggregations")
+		next["search_after"] = sort
+		body, err := json.Marshal(next)
+		if err != nil {
+			return esr, err
+		}
+		res, err := es.Query(index, kind, string(body))
+		if err != nil {
+			return esr, err
+		}
+		page, _ = res.Hits.Hits.([]interface{})
+		hits = append(hits, page...)
+	}
+	esr.Hits.Hits = hits
+
+	return esr, nil
+}
+
+// scrollAll pages through the search hits using the scroll API.
+func (es ElasticSearch) scrollAll(index, kind, jsonQuery string) (EsResponse, error) {
+	esr, err := es.scroll(index, kind, jsonQuery)
+	if err != nil {
+		return esr, err
+	}
+
+	hits, _ := esr.Hits.Hits.([]interface{})
+	page := hits
+	scrollId := esr.ScrollId
+	for len(page) > 0 && scrollId != "" {
+		res, err := es.nextScroll(scrollId)
+		if err != nil {
+			return esr, err
+		}
+		page, _ = res.Hits.Hits.([]interface{})
+		hits = append(hits, page...)
+		scrollId = res.ScrollId
+	}
+	esr.Hits.Hits = hits
+
+	if scrollId != "" {
+		if err := es.clearScroll(scrollId); err != nil {
+			return esr, err
+		}
+	}
+	esr.ScrollId = ""
+
+	return esr, nil
+}
+
+// compositeAggs returns the key the aggregations are defined with in the
+// query as well as all top level aggregations of type 'composite'.
+func compositeAggs(q map[string]interface{}) (string, map[string]map[string]interface{}) {
+	composites := make(map[string]map[string]interface{})
+	aggsKey := "aggs"
+	aggs, ok := q[aggsKey].(map[string]interface{})
+	if !ok {
+		aggsKey = "aggregations"
+		aggs, ok = q[aggsKey].(map[string]interface{})
+		if !ok {
+			return aggsKey, composites
+		}
+	}
+	for name, agg := range aggs {
+		def, ok := agg.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := def["composite"].(map[string]interface{}); ok {
+			composites[name] = def
+		}
+	}
+	return aggsKey, composites
+}
+
 func ToEsTimestamp(t time.Time) int64 {
 	i := t.Unix() * 1000
 	return i
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeEs serves search requests by passing the decoded body to 'search' and
+// returning its result as JSON. The bodies received are recorded.
+type fakeEs struct {
+	*httptest.Server
+	bodies []map[string]interface{}
+}
+
+func newFakeEs(t *testing.T, search func(body map[string]interface{}) interface{}) *fakeEs {
+	f := &fakeEs{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, &body); err != nil {
+				t.Errorf("invalid request body %s: %s", string(b), err.Error())
+			}
+		}
+		f.bodies = append(f.bodies, body)
+		json.NewEncoder(w).Encode(search(body))
+	}))
+	return f
+}
+
+func compositePage(keys []string, afterKey interface{}) map[string]interface{} {
+	var buckets []interface{}
+	for _, k := range keys {
+		buckets = append(buckets, map[string]interface{}{"key": map[string]interface{}{"host": k}, "doc_count": 1})
+	}
+	agg := map[string]interface{}{"buckets": buckets}
+	if afterKey != nil {
+		agg["after_key"] = afterKey
+	}
+	return map[string]interface{}{"aggregations": map[string]interface{}{"hosts": agg}}
+}
+
+func TestQueryAllComposite(t *testing.T) {
+	pages := map[string]map[string]interface{}{
+		"":  compositePage([]string{"a", "b"}, map[string]interface{}{"host": "b"}),
+		"b": compositePage([]string{"c"}, map[string]interface{}{"host": "c"}),
+		"c": compositePage(nil, nil),
+	}
+	es := newFakeEs(t, func(body map[string]interface{}) interface{} {
+		after := ""
+		aggs := body["aggs"].(map[string]interface{})
+		composite := aggs["hosts"].(map[string]interface{})["composite"].(map[string]interface{})
+		if a, ok := composite["after"].(map[string]interface{}); ok {
+			after = a["host"].(string)
+		}
+		return pages[after]
+	})
+	defer es.Close()
+
+	client := NewElasticSearch([]string{es.URL})
+	q := `{"size": 0, "aggs": {"hosts": {"composite": {"sources": [{"host": {"terms": {"field": "host"}}}]}}}}`
+	res, err := client.QueryAll("idx", "", q, PagingNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es.bodies) != 3 {
+		t.Errorf("expected 3 requests, got %d", len(es.bodies))
+	}
+	agg := res.Aggregations.(map[string]interface{})["hosts"].(map[string]interface{})
+	if _, ok := agg["after_key"]; ok {
+		t.Errorf("after_key should be removed from the merged response")
+	}
+	var keys []string
+	for _, b := range agg["buckets"].([]interface{}) {
+		keys = append(keys, b.(map[string]interface{})["key"].(map[string]interface{})["host"].(string))
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected buckets %v", keys)
+	}
+}
+
+func TestCompositeAggs(t *testing.T) {
+	tests := []struct {
+		query string
+		key   string
+		names []string
+	}{
+		{`{}`, "aggregations", nil},
+		{`{"aggs": {"a": {"terms": {}}}}`, "aggs", nil},
+		{`{"aggs": {"a": {"composite": {}}, "b": {"terms": {}}}}`, "aggs", []string{"a"}},
+		{`{"aggregations": {"a": {"composite": {}}}}`, "aggregations", []string{"a"}},
+		{`{"aggs": {"a": "invalid"}}`, "aggs", nil},
+	}
+	for _, test := range tests {
+		var q map[string]interface{}
+		if err := json.Unmarshal([]byte(test.query), &q); err != nil {
+			t.Fatal(err)
+		}
+		key, composites := compositeAggs(q)
+		var names []string
+		for name := range composites {
+			names = append(names, name)
+		}
+		if key != test.key || !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s: expected %s %v, got %s %v", test.query, test.key, test.names, key, names)
+		}
+	}
+}
+
+func hitsPage(ids ...float64) map[string]interface{} {
+	hits := []interface{}{}
+	for _, id := range ids {
+		hits = append(hits, map[string]interface{}{"_id": id, "sort": []interface{}{id}})
+	}
+	return map[string]interface{}{"hits": map[string]interface{}{"total": len(ids), "hits": hits}}
+}
+
+func hitIds(t *testing.T, res EsResponse) []float64 {
+	var ids []float64
+	hits, ok := res.Hits.Hits.([]interface{})
+	if !ok {
+		t.Fatalf("hits are not a list: %v", res.Hits.Hits)
+	}
+	for _, h := range hits {
+		ids = append(ids, h.(map[string]interface{})["_id"].(float64))
+	}
+	return ids
+}
+
+func TestQueryAllSearchAfter(t *testing.T) {
+	es := newFakeEs(t, func(body map[string]interface{}) interface{} {
+		after, ok := body["search_after"].([]interface{})
+		switch {
+		case !ok:
+			return hitsPage(1, 2)
+		case after[0].(float64) == 2:
+			return hitsPage(3)
+		}
+		return hitsPage()
+	})
+	defer es.Close()
+
+	client := NewElasticSearch([]string{es.URL})
+	res, err := client.QueryAll("idx", "", `{"size": 2, "sort": ["@timestamp"], "aggs": {"a": {"terms": {}}}}`, PagingSearchAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := hitIds(t, res); !reflect.DeepEqual(ids, []float64{1, 2, 3}) {
+		t.Errorf("unexpected hits %v", ids)
+	}
+	// aggregations are only requested with the first page
+	for _, body := range es.bodies[1:] {
+		if _, ok := body["aggs"]; ok {
+			t.Errorf("aggregations requested again: %v", body)
+		}
+	}
+}
+
+func TestQueryAllSearchAfterWithoutSort(t *testing.T) {
+	es := newFakeEs(t, func(body map[string]interface{}) interface{} {
+		return map[string]interface{}{"hits": map[string]interface{}{"hits": []interface{}{map[string]interface{}{"_id": 1}}}}
+	})
+	defer es.Close()
+
+	client := NewElasticSearch([]string{es.URL})
+	if _, err := client.QueryAll("idx", "", `{}`, PagingSearchAfter); err == nil {
+		t.Errorf("expected an error for hits without sort values")
+	}
+}
+
+func TestQueryAllScroll(t *testing.T) {
+	var cleared bool
+	page := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			cleared = true
+			return
+		}
+		page++
+		res := hitsPage()
+		switch page {
+		case 1:
+			res = hitsPage(1, 2)
+		case 2:
+			res = hitsPage(3)
+		}
+		res["_scroll_id"] = "abc"
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	client := NewElasticSearch([]string{srv.URL})
+	res, err := client.QueryAll("idx", "", `{}`, PagingScroll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := hitIds(t, res); !reflect.DeepEqual(ids, []float64{1, 2, 3}) {
+		t.Errorf("unexpected hits %v", ids)
+	}
+	if res.ScrollId != "" {
+		t.Errorf("scroll id should be removed from the merged response")
+	}
+	if !cleared {
+		t.Errorf("scroll was not cleared")
+	}
+}
+
+func TestResponseRoot(t *testing.T) {
+	var res EsResponse
+	if err := json.Unmarshal([]byte(`{"took": 3, "aggregations": {"a": 1}}`), &res); err != nil {
+		t.Fatal(err)
+	}
+	aggs, err := res.Root(RootAggregations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aggs) != `{"a":1}` {
+		t.Errorf("unexpected aggregations %s", string(aggs))
+	}
+	whole, err := res.Root(RootResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(whole, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["took"] != float64(3) {
+		t.Errorf("whole response expected, got %s", string(whole))
+	}
+}
+
+func TestEsTotal(t *testing.T) {
+	tests := []struct {
+		in       string
+		value    float64
+		relation string
+		err      bool
+	}{
+		{`12`, 12, "eq", false},
+		{`{"value": 10000, "relation": "gte"}`, 10000, "gte", false},
+		{`{"value": 3, "relation": "eq"}`, 3, "eq", false},
+		{`"many"`, 0, "", true},
+	}
+	for _, test := range tests {
+		var total EsTotal
+		err := json.Unmarshal([]byte(test.in), &total)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err.Error())
+			continue
+		}
+		if total.Value != test.value || total.Relation != test.relation {
+			t.Errorf("%s: expected %v %s, got %v %s", test.in, test.value, test.relation, total.Value, total.Relation)
+		}
+		b, err := json.Marshal(total)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != strconv.FormatFloat(test.value, 'f', -1, 64) {
+			t.Errorf("%s: total should be written as number, got %s", test.in, string(b))
+		}
+	}
+}
+
+func TestEsInfo(t *testing.T) {
+	tests := []struct {
+		in       string
+		major    int
+		typeless bool
+		str      string
+	}{
+		{`{"version": {"number": "5.6.16"}}`, 5, false, "ElasticSearch 5.6.16"},
+		{`{"version": {"number": "6.8.0"}}`, 6, false, "ElasticSearch 6.8.0"},
+		{`{"version": {"number": "7.10.2"}}`, 7, true, "ElasticSearch 7.10.2"},
+		{`{"version": {"number": "8.11.1"}}`, 8, true, "ElasticSearch 8.11.1"},
+		{`{"version": {"number": "1.3.0", "distribution": "opensearch"}}`, 1, true, "OpenSearch 1.3.0"},
+	}
+	for _, test := range tests {
+		var info EsInfo
+		if err := json.Unmarshal([]byte(test.in), &info); err != nil {
+			t.Fatal(err)
+		}
+		if info.Major() != test.major || info.Typeless() != test.typeless || info.String() != test.str {
+			t.Errorf("%s: expected %d %v %s, got %d %v %s", test.in, test.major, test.typeless, test.str, info.Major(), info.Typeless(), info.String())
+		}
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	tests := []struct {
+		typeless, ignore bool
+		kind             string
+		path             string
+	}{
+		{false, false, "www", "/idx/www/_search?pretty"},
+		{false, false, "", "/idx/_search?pretty"},
+		{true, false, "www", "/idx/_search?pretty"},
+		{true, true, "www", "/idx/_search?pretty&ignore_unavailable=true"},
+	}
+	for _, test := range tests {
+		es := ElasticSearch{Typeless: test.typeless, IgnoreUnavailable: test.ignore}
+		if path := es.searchPath("idx", test.kind); path != test.path {
+			t.Errorf("expected %s, got %s", test.path, path)
+		}
+	}
+}
+
+func TestNewEsResponseError(t *testing.T) {
+	body := `{"error": {"type": "search_phase_execution_exception", "reason": "all shards failed", "line": 3,
+		"caused_by": {"type": "parsing_exception", "reason": "unknown query"}}, "status": 400}`
+	_, err := NewEsResponse(strings.NewReader(body))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	expected := "elasticsearch error 'search_phase_execution_exception' occurred on line 3: all shards failed, caused by 'parsing_exception': unknown query"
+	if err.Error() != expected {
+		t.Errorf("expected %s, got %s", expected, err.Error())
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// exploreMaxLines limits the lines of a result printed by the explorer.
+const exploreMaxLines = 40
+
+const exploreHelp = `Enter a jee expression to evaluate it on the current element, eg.
+'.over_time.buckets[]'. Press tab to complete keys. Available commands:
+
+  :iterate SELECTOR [N]  add an iterator and enter its N-th element (default 0)
+  :up                    leave the current iterator
+  :time SELECTOR         set the time selector of the current iterator
+  :tag NAME SELECTOR     add a tag to the current iterator
+  :value NAME SELECTOR   add a value to the current iterator
+  :keys                  list the keys of the current element
+  :yaml                  print the iterators built so far as YAML
+  :help                  print this help
+  :quit                  leave the explorer
+`
+
+var exploreCommands = []string{":iterate", ":up", ":time", ":tag", ":value", ":keys", ":yaml", ":help", ":quit"}
+
+// exploreLevel is an iterator entered in the explorer.
+type exploreLevel struct {
+	iterator *Iterator
+	element  interface{}
+	json     []byte
+	path     string
+}
+
+// Explorer evaluates jee expressions on a response and records the selectors
+// used as iterators.
+type Explorer struct {
+	root   Iterator
+	levels []*exploreLevel
+	out    io.Writer
+}
+
+func NewExplorer(doc []byte, out io.Writer) (*Explorer, error) {
+	var element interface{}
+	if err := json.Unmarshal(doc, &element); err != nil {
+		return nil, err
+	}
+	return &Explorer{
+		levels: []*exploreLevel{{element: element, json: doc}},
+		out:    out,
+	}, nil
+}
+
+func (e *Explorer) current() *exploreLevel {
+	return e.levels[len(e.levels)-1]
+}
+
+// Prompt returns the prompt showing the selectors of the iterators entered.
+func (e *Explorer) Prompt() string {
+	var path []string
+	for _, l := range e.levels[1:] {
+		path = append(path, l.path)
+	}
+	return strings.Join(path, " ") + "> "
+}
+
+// Run reads lines from 'r' until the input ends or ':quit' is entered.
+func (e *Explorer) Run(r *LineReader) error {
+	r.Complete = e.Complete
+	fmt.Fprintln(e.out, "Type ':help' for help.")
+	for {
+		line, err := r.ReadLine(e.Prompt())
+		if err == errInterrupt {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(line) == ":quit" {
+			return nil
+		}
+		if err := e.Exec(line); err != nil {
+			fmt.Fprintf(e.out, "error: %s\n", err.Error())
+		}
+	}
+}
+
+// Exec evaluates an expression or runs a command.
+func (e *Explorer) Exec(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	if !strings.HasPrefix(line, ":") {
+		result, err := query(e.current().json, line)
+		if err != nil {
+			return err
+		}
+		e.print(result)
+		return nil
+	}
+
+	fields := strings.Fields(line)
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case ":help":
+		fmt.Fprint(e.out, exploreHelp)
+	case ":keys":
+		fmt.Fprintln(e.out, strings.Join(keysOf(e.current().element), "\n"))
+	case ":yaml":
+		b, err := yaml.Marshal(map[string]interface{}{"ruminate": map[string]interface{}{"iterator": e.root}})
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(e.out, string(b))
+	case ":iterate":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("usage: :iterate SELECTOR [N]")
+		}
+		n := 0
+		if len(args) == 2 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("element must be a number: %s", err.Error())
+			}
+		}
+		return e.iterate(args[0], n)
+	case ":up":
+		if len(e.levels) < 2 {
+			return fmt.Errorf("no iterator entered")
+		}
+		e.levels = e.levels[:len(e.levels)-1]
+	case ":time":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: :time SELECTOR")
+		}
+		i, err := e.iterator()
+		if err != nil {
+			return err
+		}
+		if err := e.preview(args[0]); err != nil {
+			return err
+		}
+		i.Time = args[0]
+	case ":tag", ":value":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s NAME SELECTOR", cmd)
+		}
+		i, err := e.iterator()
+		if err != nil {
+			return err
+		}
+		if err := e.preview(args[1]); err != nil {
+			return err
+		}
+		if cmd == ":tag" {
+			if i.Tags == nil {
+				i.Tags = make(map[string]string)
+			}
+			i.Tags[args[0]] = args[1]
+		} else {
+			if i.Values == nil {
+				i.Values = make(map[string]string)
+			}
+			i.Values[args[0]] = args[1]
+		}
+	default:
+		return fmt.Errorf("unknown command '%s', type ':help' for help", cmd)
+	}
+	return nil
+}
+
+// iterator returns the iterator entered last.
+func (e *Explorer) iterator() (*Iterator, error) {
+	if len(e.levels) < 2 {
+		return nil, fmt.Errorf("no iterator entered, use ':iterate' first")
+	}
+	return e.current().iterator, nil
+}
+
+// preview evaluates and prints a selector before it is recorded.
+func (e *Explorer) preview(selector string) error {
+	result, err := query(e.current().json, selector)
+	if err != nil {
+		return err
+	}
+	e.print(result)
+	return nil
+}
+
+func (e *Explorer) iterate(selector string, n int) error {
+	result, err := query(e.current().json, selector)
+	if err != nil {
+		return err
+	}
+	elements, ok := result.([]interface{})
+	if !ok {
+		return fmt.Errorf("'%s' does not select an array", selector)
+	}
+	if n < 0 || n >= len(elements) {
+		return fmt.Errorf("'%s' selects %d elements, element %d does not exist", selector, len(elements), n)
+	}
+	b, err := json.Marshal(elements[n])
+	if err != nil {
+		return err
+	}
+
+	// the root iterator is the first one, all others are nested
+	var i *Iterator
+	if len(e.levels) == 1 {
+		e.root = Iterator{Selector: selector}
+		i = &e.root
+	} else {
+		parent := e.current().iterator
+		parent.Iterators = append(parent.Iterators, Iterator{Selector: selector})
+		i = &parent.Iterators[len(parent.Iterators)-1]
+	}
+	e.levels = append(e.levels, &exploreLevel{
+		iterator: i,
+		element:  elements[n],
+		json:     b,
+		path:     fmt.Sprintf("%s[%d]", strings.TrimSuffix(selector, "[]"), n),
+	})
+	fmt.Fprintf(e.out, "entered element %d of %d\n", n, len(elements))
+	return nil
+}
+
+func (e *Explorer) print(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(e.out, "%v\n", v)
+		return
+	}
+	lines := strings.Split(string(b), "\n")
+	if len(lines) > exploreMaxLines {
+		fmt.Fprintln(e.out, strings.Join(lines[:exploreMaxLines], "\n"))
+		fmt.Fprintf(e.out, "... %d more lines\n", len(lines)-exploreMaxLines)
+		return
+	}
+	fmt.Fprintln(e.out, string(b))
+}
+
+// Complete returns the candidates completing the last word of a line, either
+// a command or the key of an object selected by the expression typed so far.
+func (e *Explorer) Complete(line string) []string {
+	head, word := "", line
+	if i := strings.LastIndex(line, " "); i >= 0 {
+		head, word = line[:i+1], line[i+1:]
+	}
+
+	var candidates []string
+	if head == "" && strings.HasPrefix(word, ":") {
+		for _, cmd := range exploreCommands {
+			if strings.HasPrefix(cmd, word) {
+				candidates = append(candidates, cmd+" ")
+			}
+		}
+		return candidates
+	}
+
+	dot := strings.LastIndex(word, ".")
+	if dot < 0 {
+		return nil
+	}
+	base, prefix := word[:dot], word[dot+1:]
+	var selected interface{} = e.current().element
+	if base != "" {
+		var err error
+		if selected, err = query(e.current().json, base); err != nil {
+			return nil
+		}
+	}
+	// complete the keys of the first element if an array is selected
+	if elements, ok := selected.([]interface{}); ok && len(elements) > 0 {
+		selected = elements[0]
+	}
+	for _, key := range keysOf(selected) {
+		if strings.HasPrefix(key, prefix) {
+			candidates = append(candidates, head+base+"."+key)
+		}
+	}
+	return candidates
+}
+
+func keysOf(v interface{}) []string {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const exploreDoc = `{"over_time": {"buckets": [
+	{"key": 1583064000000, "by_domain": {"buckets": [{"key": "a.com", "doc_count": 3, "bytes": {"value": 10}}]}},
+	{"key": 1583067600000, "by_domain": {"buckets": []}}
+]}}`
+
+func TestExplorer(t *testing.T) {
+	var out bytes.Buffer
+	e, err := NewExplorer([]byte(exploreDoc), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{
+		":iterate .over_time.buckets[]",
+		":time .key",
+		":iterate .by_domain.buckets[]",
+		":tag domain .key",
+		":value requests .doc_count",
+		":value bytes .bytes.value",
+	}
+	for _, line := range lines {
+		if err := e.Exec(line); err != nil {
+			t.Fatalf("%s: %s", line, err.Error())
+		}
+	}
+	if p := e.Prompt(); p != ".over_time.buckets[0] .by_domain.buckets[0]> " {
+		t.Errorf("unexpected prompt %s", p)
+	}
+	expected := Iterator{
+		Selector: ".over_time.buckets[]",
+		Time:     ".key",
+		Iterators: []Iterator{{
+			Selector: ".by_domain.buckets[]",
+			Tags:     map[string]string{"domain": ".key"},
+			Values:   map[string]string{"requests": ".doc_count", "bytes": ".bytes.value"},
+		}},
+	}
+	if !reflect.DeepEqual(e.root, expected) {
+		t.Errorf("expected iterator %+v, got %+v", expected, e.root)
+	}
+
+	out.Reset()
+	if err := e.Exec(":yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "    selector: .over_time.buckets[]\n") {
+		t.Errorf("unexpected YAML %s", out.String())
+	}
+
+	if err := e.Exec(":up"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Exec(":up"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Exec(":up"); err == nil {
+		t.Errorf("expected an error leaving the root")
+	}
+}
+
+func TestExplorerErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		err  string
+	}{
+		{":tag a .key", "no iterator entered"},
+		{":iterate", "usage: :iterate SELECTOR [N]"},
+		{":iterate .over_time", "does not select an array"},
+		{":iterate .over_time.buckets[] 2", "selects 2 elements, element 2 does not exist"},
+		{":iterate .over_time.buckets[] x", "element must be a number"},
+		{":frobnicate", "unknown command ':frobnicate'"},
+	}
+	for _, test := range tests {
+		e, err := NewExplorer([]byte(exploreDoc), &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Exec(test.line); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error '%s', got %v", test.line, test.err, err)
+		}
+	}
+}
+
+func TestExplorerComplete(t *testing.T) {
+	e, err := NewExplorer([]byte(exploreDoc), &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line       string
+		candidates []string
+	}{
+		{":it", []string{":iterate "}},
+		{":q", []string{":quit "}},
+		{".", []string{".over_time"}},
+		{".over_time.b", []string{".over_time.buckets"}},
+		{":iterate .over_time.buckets[].", []string{":iterate .over_time.buckets[].by_domain", ":iterate .over_time.buckets[].key"}},
+		{"over", nil},
+		{".missing.", nil},
+	}
+	for _, test := range tests {
+		candidates := e.Complete(test.line)
+		if !reflect.DeepEqual(candidates, test.candidates) {
+			t.Errorf("%s: expected %v, got %v", test.line, test.candidates, candidates)
+		}
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		list   []string
+		prefix string
+	}{
+		{[]string{"abc"}, "abc"},
+		{[]string{".over_time", ".over_all"}, ".over_"},
+		{[]string{"a", "b"}, ""},
+	}
+	for _, test := range tests {
+		if p := commonPrefix(test.list); p != test.prefix {
+			t.Errorf("%v: expected %s, got %s", test.list, test.prefix, p)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+
+	jmespath "github.com/jmespath/go-jmespath"
+	jee "github.com/nytlabs/gojee"
+)
+
+// Languages the expressions of an iterator can be written in.
+const (
+	LangJee      = "jee"
+	LangJMESPath = "jmespath"
+	LangJSONPath = "jsonpath"
+)
+
+// Langs lists the supported expression languages.
+var Langs = []string{LangJee, LangJMESPath, LangJSONPath}
+
+func isLang(lang string) bool {
+	for _, l := range Langs {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Expression is a compiled expression selecting data from a JSON document
+// decoded with encoding/json.
+type Expression interface {
+	Eval(doc interface{}) (interface{}, error)
+}
+
+// CompileExpression compiles an expression written in the language given.
+func CompileExpression(lang, src string) (Expression, error) {
+	switch lang {
+	case LangJee, "":
+		return compileJee(src)
+	case LangJMESPath:
+		p, err := jmespath.Compile(src)
+		if err != nil {
+			return nil, err
+		}
+		return jmespathExpression{p}, nil
+	case LangJSONPath:
+		return compileJSONPath(src)
+	default:
+		return nil, fmt.Errorf("unsupported expression language '%s'", lang)
+	}
+}
+
+// jmespathExpression is a compiled JMESPath expression.
+type jmespathExpression struct {
+	path *jmespath.JMESPath
+}
+
+func (e jmespathExpression) Eval(doc interface{}) (interface{}, error) {
+	return e.path.Search(doc)
+}
+
+// jeeExpression is a compiled jee expression.
+type jeeExpression struct {
+	src  string
+	tree *jee.TokenTree
+	// jee resolves keys in bracket notation such as '["key"]' when they are
+	// evaluated first and stores the result in the tree. Constant keys are
+	// thus resolved at compile time, expressions with keys depending on the
+	// element are parsed for every evaluation.
+	dynamic bool
+}
+
+func compileJee(src string) (Expression, error) {
+	tree, err := compileTree(src)
+	if err != nil {
+		return nil, err
+	}
+	e := &jeeExpression{src: src, tree: tree}
+	e.dynamic = !resolveKeys(tree)
+	return e, nil
+}
+
+func (e *jeeExpression) Eval(doc interface{}) (interface{}, error) {
+	tree := e.tree
+	if e.dynamic {
+		var err error
+		if tree, err = compileTree(e.src); err != nil {
+			return nil, err
+		}
+	}
+	return jee.Eval(tree, doc)
+}
+
+// resolveKeys resolves all constant keys in bracket notation the way jee
+// does on evaluation. False is returned if a key is not constant.
+func resolveKeys(t *jee.TokenTree) bool {
+	resolved := true
+	if t.Type == jee.KEY {
+		for _, sub := range t.Tokens {
+			if len(sub.Tokens) < 1 {
+				continue
+			}
+			key := sub.Tokens[0]
+			switch key.Type {
+			case jee.S_STR, jee.D_STR, jee.CONST:
+				if len(key.Tokens) > 0 {
+					resolved = false
+					continue
+				}
+				if _, ok := key.Value.(string); ok {
+					sub.Type = jee.KEY
+				}
+				sub.Value = key.Value
+				sub.Tokens = nil
+			default:
+				resolved = false
+			}
+		}
+	}
+	for _, sub := range t.Tokens {
+		if !resolveKeys(sub) {
+			resolved = false
+		}
+	}
+	return resolved
+}
+
+// compileTree lexes and parses a jee expression. jee panics on some malformed
+// expressions, these are returned as error.
+func compileTree(q string) (tree *jee.TokenTree, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	l, err := jee.Lexer(q)
+	if err != nil {
+		return nil, err
+	}
+	return jee.Parser(l)
+}
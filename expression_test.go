@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	jee "github.com/nytlabs/gojee"
+)
+
+// evalUncompiled evaluates a jee expression the way it was done before
+// expressions were compiled, by parsing it for every evaluation.
+func evalUncompiled(src string, doc interface{}) (interface{}, error) {
+	tree, err := compileTree(src)
+	if err != nil {
+		return nil, err
+	}
+	return jee.Eval(tree, doc)
+}
+
+// chewUncompiled processes a document like Chew, parsing every expression
+// for every element.
+func chewUncompiled(t testing.TB, doc interface{}, i Iterator, inherited Point) []Point {
+	selected, err := evalUncompiled(i.Selector, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var points []Point
+	elements, _ := selected.([]interface{})
+	for _, elem := range elements {
+		p := inherited.Copy()
+		if i.Time != "" {
+			out, err := evalUncompiled(i.Time, elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Timestamp = time.Unix(0, int64(out.(float64))*int64(time.Millisecond))
+		}
+		for key, sel := range i.Tags {
+			out, err := evalUncompiled(sel, elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Tags[key] = tagValue(out)
+		}
+		for key, sel := range i.Values {
+			out, err := evalUncompiled(sel, elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Values[key] = out
+		}
+		if len(i.Iterators) < 1 {
+			points = append(points, p)
+		}
+		for _, nested := range i.Iterators {
+			points = append(points, chewUncompiled(t, elem, nested, p)...)
+		}
+	}
+	return points
+}
+
+// largeResponse generates a response of a date histogram with 'hours'
+// buckets, each holding 'domains' terms buckets.
+func largeResponse(hours, domains int) []byte {
+	start := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	var overTime []interface{}
+	for h := 0; h < hours; h++ {
+		var byDomain []interface{}
+		for d := 0; d < domains; d++ {
+			byDomain = append(byDomain, map[string]interface{}{
+				"key":        fmt.Sprintf("domain-%d.example.com", d),
+				"doc_count":  h*domains + d,
+				"bytes_sent": map[string]interface{}{"value": float64(d) * 1.5},
+				"latency":    map[string]interface{}{"values": map[string]interface{}{"95.0": float64(h)}},
+			})
+		}
+		overTime = append(overTime, map[string]interface{}{
+			"key":       start.Add(time.Duration(h)*time.Hour).UnixNano() / int64(time.Millisecond),
+			"doc_count": domains,
+			"by_domain": map[string]interface{}{"buckets": byDomain},
+		})
+	}
+	b, _ := json.Marshal(map[string]interface{}{"over_time": map[string]interface{}{"buckets": overTime}})
+	return b
+}
+
+func largeIterator() Iterator {
+	return Iterator{
+		Selector: ".over_time.buckets[]",
+		Time:     ".key",
+		Iterators: []Iterator{{
+			Selector: ".by_domain.buckets[]",
+			Tags:     map[string]string{"domain": ".key"},
+			Values: map[string]string{
+				"request_count": ".doc_count",
+				"bytes_sent":    ".bytes_sent.value",
+				"latency_p95":   `.latency.values["95.0"]`,
+			},
+		}},
+	}
+}
+
+func emptyPoint() Point {
+	return Point{Tags: map[string]string{}, Values: map[string]interface{}{}}
+}
+
+func TestChewCompiledMatchesUncompiled(t *testing.T) {
+	response := largeResponse(24, 10)
+	var doc interface{}
+	if err := json.Unmarshal(response, &doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := chewUncompiled(t, doc, largeIterator(), emptyPoint())
+
+	// an iterator compiled once is used for several responses
+	i := largeIterator()
+	if err := i.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		points, err := Chew(response, i, emptyPoint())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != 240 || !reflect.DeepEqual(points, expected) {
+			t.Fatalf("run %d: compiled iterator returns %d points differing from %d expected", run, len(points), len(expected))
+		}
+	}
+}
+
+func TestResolveKeys(t *testing.T) {
+	doc := map[string]interface{}{
+		"a":     map[string]interface{}{"b": 1.0, "x-y": 2.0, "95.0": 3.0},
+		"name":  "b",
+		"list":  []interface{}{10.0, 20.0},
+		"a b":   4.0,
+		"index": 1.0,
+	}
+	tests := []struct {
+		src      string
+		resolved bool
+	}{
+		{".a.b", true},
+		{`.a["b"]`, true},
+		{`.a['x-y']`, true},
+		{`.a["95.0"]`, true},
+		{`.["a b"]`, true},
+		{".list[1]", true},
+		{".list[]", true},
+		{".a[.name]", false},
+		{".list[.index]", false},
+	}
+	for _, test := range tests {
+		tree, err := compileTree(test.src)
+		if err != nil {
+			t.Fatalf("%s: %s", test.src, err.Error())
+		}
+		if resolved := resolveKeys(tree); resolved != test.resolved {
+			t.Errorf("%s: expected resolved %v, got %v", test.src, test.resolved, resolved)
+		}
+
+		e, err := CompileExpression(LangJee, test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := evalUncompiled(test.src, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// evaluated twice, as jee stores resolved keys in the tree
+		for run := 0; run < 2; run++ {
+			out, err := e.Eval(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out, expected) {
+				t.Errorf("%s: expected %v, got %v", test.src, expected, out)
+			}
+		}
+	}
+}
+
+func TestExpressionConcurrentEval(t *testing.T) {
+	sources := []string{".a.b", `.a["x-y"]`, ".a[.name]", ".list[1]"}
+	var docs []interface{}
+	for n := 0; n < 20; n++ {
+		docs = append(docs, map[string]interface{}{
+			"a":    map[string]interface{}{"b": float64(n), "x-y": float64(-n), "c": "c"},
+			"name": []string{"b", "x-y", "c"}[n%3],
+			"list": []interface{}{float64(n), float64(n * 2)},
+		})
+	}
+	for _, src := range sources {
+		e, err := CompileExpression(LangJee, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, doc := range docs {
+					expected, err := evalUncompiled(src, doc)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					out, err := e.Eval(doc)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if !reflect.DeepEqual(out, expected) {
+						t.Errorf("%s: expected %v, got %v", src, expected, out)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func BenchmarkChew(b *testing.B) {
+	response := largeResponse(168, 50)
+	i := largeIterator()
+	if err := i.Compile(); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := Chew(response, i, emptyPoint()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkChewUncompiled parses the expressions for every element, as was
+// done before iterators were compiled, for comparison with BenchmarkChew.
+func BenchmarkChewUncompiled(b *testing.B) {
+	response := largeResponse(168, 50)
+	i := largeIterator()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var doc interface{}
+		if err := json.Unmarshal(response, &doc); err != nil {
+			b.Fatal(err)
+		}
+		chewUncompiled(b, doc, i, emptyPoint())
+	}
+}
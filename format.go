@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats the points of 'vomit' and 'burp' can be printed in.
+const (
+	FormatTable        = "table"
+	FormatJSON         = "json"
+	FormatNDJSON       = "ndjson"
+	FormatCSV          = "csv"
+	FormatLineProtocol = "lineprotocol"
+)
+
+var Formats = []string{FormatTable, FormatJSON, FormatNDJSON, FormatCSV, FormatLineProtocol}
+
+// PointWriter writes points in one of the formats supported. Points are
+// sorted by timestamp and tags, tags and values by their keys. Formats that
+// require all points to be known, such as the header of CSV, are written by
+// Close, all others are written as they are passed.
+type PointWriter struct {
+	w        io.Writer
+	format   string
+	series   string
+	buffered []Point
+}
+
+func NewPointWriter(w io.Writer, format, series string) (*PointWriter, error) {
+	supported := false
+	for _, f := range Formats {
+		supported = supported || f == format
+	}
+	if !supported {
+		return nil, fmt.Errorf("unsupported format '%s', must be one of %s", format, strings.Join(Formats, ", "))
+	}
+	if series == "" {
+		series = caseSeries
+	}
+	return &PointWriter{w: w, format: format, series: series}, nil
+}
+
+func (pw *PointWriter) Write(points []Point) error {
+	switch pw.format {
+	case FormatJSON, FormatCSV:
+		pw.buffered = append(pw.buffered, points...)
+		return nil
+	}
+
+	points = SortPoints(points)
+	for _, p := range points {
+		var err error
+		switch pw.format {
+		case FormatTable:
+			_, err = fmt.Fprintln(pw.w, p)
+		case FormatNDJSON:
+			var b []byte
+			if b, err = json.Marshal(newPointDoc(p)); err == nil {
+				_, err = fmt.Fprintln(pw.w, string(b))
+			}
+		case FormatLineProtocol:
+			var line string
+			if line, err = p.LineProtocol(pw.series); err == nil {
+				_, err = fmt.Fprintln(pw.w, line)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close writes the points of the formats buffered.
+func (pw *PointWriter) Close() error {
+	points := SortPoints(pw.buffered)
+	pw.buffered = nil
+	switch pw.format {
+	case FormatJSON:
+		docs := []pointDoc{}
+		for _, p := range points {
+			docs = append(docs, newPointDoc(p))
+		}
+		b, err := json.MarshalIndent(docs, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(pw.w, string(b))
+		return err
+	case FormatCSV:
+		return writePointsCsv(pw.w, points)
+	}
+	return nil
+}
+
+// writePointsCsv writes the points as CSV with a column for the time, every
+// tag and every value found in any of the points.
+func writePointsCsv(w io.Writer, points []Point) error {
+	tagSet := make(map[string]string)
+	valueSet := make(map[string]string)
+	for _, p := range points {
+		for key := range p.Tags {
+			tagSet[key] = ""
+		}
+		for key := range p.Values {
+			valueSet[key] = ""
+		}
+	}
+	tags, values := sortedKeys(tagSet), sortedKeys(valueSet)
+
+	cw := csv.NewWriter(w)
+	header := append(append([]string{"time"}, tags...), values...)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, p := range points {
+		row := make([]string, 0, len(header))
+		row = append(row, formatTime(p.Timestamp))
+		for _, key := range tags {
+			row = append(row, p.Tags[key])
+		}
+		for _, key := range values {
+			row = append(row, formatValue(p.Values[key]))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool, int, int64:
+		return fmt.Sprint(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// SortPoints returns the points sorted by timestamp and then by tags.
+func SortPoints(points []Point) []Point {
+	type keyed struct {
+		point Point
+		tags  string
+	}
+	list := make([]keyed, len(points))
+	for n, p := range points {
+		var tags []string
+		for _, key := range sortedKeys(p.Tags) {
+			tags = append(tags, key+"="+p.Tags[key])
+		}
+		list[n] = keyed{p, strings.Join(tags, ",")}
+	}
+	sort.SliceStable(list, func(a, b int) bool {
+		if !list[a].point.Timestamp.Equal(list[b].point.Timestamp) {
+			return list[a].point.Timestamp.Before(list[b].point.Timestamp)
+		}
+		return list[a].tags < list[b].tags
+	})
+	sorted := make([]Point, len(points))
+	for n, k := range list {
+		sorted[n] = k.point
+	}
+	return sorted
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func formatTestPoints() []Point {
+	t0 := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	return []Point{
+		{Timestamp: t0.Add(time.Hour), Tags: map[string]string{"host": "a"}, Values: map[string]interface{}{"n": 3.0}},
+		{Timestamp: t0, Tags: map[string]string{"host": "b"}, Values: map[string]interface{}{"n": 2.0, "msg": "x,y"}},
+		{Timestamp: t0, Tags: map[string]string{"host": "a"}, Values: map[string]interface{}{"n": 1.5, "ok": true}},
+	}
+}
+
+func TestSortPoints(t *testing.T) {
+	t0 := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	points := []Point{
+		{Timestamp: t0.Add(time.Second), Tags: map[string]string{"a": "1"}},
+		{Timestamp: t0, Tags: map[string]string{"b": "1"}},
+		{Timestamp: t0, Tags: map[string]string{"a": "2"}},
+		{Timestamp: t0, Tags: map[string]string{"a": "1", "b": "2"}},
+		{Timestamp: t0, Tags: map[string]string{"a": "1"}},
+	}
+	sorted := SortPoints(points)
+	var order []string
+	for _, p := range sorted {
+		var tags []string
+		for _, key := range sortedKeys(p.Tags) {
+			tags = append(tags, key+"="+p.Tags[key])
+		}
+		order = append(order, p.Timestamp.Format("05")+" "+strings.Join(tags, ","))
+	}
+	expected := []string{"00 a=1", "00 a=1,b=2", "00 a=2", "00 b=1", "01 a=1"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %v, got %v", expected, order)
+	}
+	// the points passed are left untouched
+	if !points[0].Timestamp.Equal(t0.Add(time.Second)) {
+		t.Errorf("points passed were reordered")
+	}
+}
+
+func TestPointWriter(t *testing.T) {
+	tests := []struct {
+		format string
+		out    string
+	}{
+		{FormatNDJSON, `{"time":"2020-03-01T12:00:00Z","tags":{"host":"a"},"values":{"n":1.5,"ok":true}}
+{"time":"2020-03-01T12:00:00Z","tags":{"host":"b"},"values":{"msg":"x,y","n":2}}
+{"time":"2020-03-01T13:00:00Z","tags":{"host":"a"},"values":{"n":3}}
+`},
+		{FormatCSV, `time,host,msg,n,ok
+2020-03-01T12:00:00Z,a,,1.5,true
+2020-03-01T12:00:00Z,b,"x,y",2,
+2020-03-01T13:00:00Z,a,,3,
+`},
+		{FormatLineProtocol, `www,host=a n=1.5,ok=true 1583064000000000000
+www,host=b msg="x,y",n=2 1583064000000000000
+www,host=a n=3 1583067600000000000
+`},
+		{FormatJSON, `[
+  {
+    "time": "2020-03-01T12:00:00Z",
+    "tags": {
+      "host": "a"
+    },
+    "values": {
+      "n": 1.5,
+      "ok": true
+    }
+  },
+  {
+    "time": "2020-03-01T12:00:00Z",
+    "tags": {
+      "host": "b"
+    },
+    "values": {
+      "msg": "x,y",
+      "n": 2
+    }
+  },
+  {
+    "time": "2020-03-01T13:00:00Z",
+    "tags": {
+      "host": "a"
+    },
+    "values": {
+      "n": 3
+    }
+  }
+]
+`},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		pw, err := NewPointWriter(&out, test.format, "www")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pw.Write(formatTestPoints()); err != nil {
+			t.Fatal(err)
+		}
+		if err := pw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.out {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.format, test.out, out.String())
+		}
+	}
+}
+
+func TestPointWriterBuffering(t *testing.T) {
+	tests := []struct {
+		format   string
+		buffered bool
+	}{
+		{FormatTable, false},
+		{FormatNDJSON, false},
+		{FormatLineProtocol, false},
+		{FormatJSON, true},
+		{FormatCSV, true},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		pw, err := NewPointWriter(&out, test.format, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pw.Write(formatTestPoints()); err != nil {
+			t.Fatal(err)
+		}
+		if written := out.Len() > 0; written == test.buffered {
+			t.Errorf("%s: expected buffered %v, but written before close %v", test.format, test.buffered, written)
+		}
+		if err := pw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if out.Len() < 1 {
+			t.Errorf("%s: nothing written", test.format)
+		}
+	}
+}
+
+func TestPointWriterTable(t *testing.T) {
+	var out bytes.Buffer
+	pw, err := NewPointWriter(&out, FormatTable, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.Write(formatTestPoints()); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	first := strings.Index(out.String(), "@2020-03-01 12:00:00")
+	last := strings.Index(out.String(), "@2020-03-01 13:00:00")
+	if first < 0 || last < first {
+		t.Errorf("points not sorted by time:\n%s", out.String())
+	}
+}
+
+func TestPointWriterErrors(t *testing.T) {
+	if _, err := NewPointWriter(&bytes.Buffer{}, "xml", ""); err == nil || !strings.Contains(err.Error(), "unsupported format 'xml'") {
+		t.Errorf("expected an error for an unsupported format, got %v", err)
+	}
+	pw, err := NewPointWriter(&bytes.Buffer{}, FormatLineProtocol, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.Write([]Point{{Values: map[string]interface{}{"v": nil}}}); err == nil {
+		t.Errorf("expected an error for a point without values")
+	}
+}
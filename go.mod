@@ -5,11 +5,12 @@ go 1.13
 require (
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/influxdata/influxdb v1.2.3-0.20170331210902-15e594fc09f1
+	github.com/jmespath/go-jmespath v0.3.0
 	github.com/kr/pretty v0.2.0 // indirect
 	github.com/nytlabs/gojee v0.0.0-20140331152115-5a79a1542dc0
 	github.com/spf13/cobra v0.0.0-20170905172051-b78744579491
 	github.com/spf13/pflag v1.0.1-0.20170901120850-7aff26db30c1 // indirect
-	github.com/stretchr/testify v1.4.0 // indirect
+	github.com/stretchr/testify v1.5.1 // indirect
 	go.uber.org/atomic v1.1.0 // indirect
 	go.uber.org/zap v1.0.0-rc.1.0.20170216044757-066278dd4c1d
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	unitHour = iota
+	unitDay
+	unitMonth
+	unitYear
+)
+
+// indexTokens maps the date format tokens supported in index patterns to a
+// function formatting the respective part of a timestamp and to the unit of
+// time they represent. Longer tokens must be listed first.
+var indexTokens = []struct {
+	token  string
+	unit   int
+	format func(t time.Time) string
+}{
+	{"yyyy", unitYear, func(t time.Time) string { return fmt.Sprintf("%04d", t.Year()) }},
+	{"yy", unitYear, func(t time.Time) string { return fmt.Sprintf("%02d", t.Year()%100) }},
+	{"MM", unitMonth, func(t time.Time) string { return fmt.Sprintf("%02d", int(t.Month())) }},
+	{"dd", unitDay, func(t time.Time) string { return fmt.Sprintf("%02d", t.Day()) }},
+	{"HH", unitHour, func(t time.Time) string { return fmt.Sprintf("%02d", t.Hour()) }},
+}
+
+// IndexPattern expands index names containing a date format such as
+// 'logstash-{yyyy.MM.dd}' to the list of indices covering a time window.
+// Supported tokens within the curly braces are 'yyyy', 'yy', 'MM', 'dd' and
+// 'HH', all other characters are kept as they are.
+type IndexPattern struct {
+	pattern  string
+	parts    []func(t time.Time) string
+	unit     int
+	location *time.Location
+	dynamic  bool
+}
+
+func NewIndexPattern(pattern, timezone string) (IndexPattern, error) {
+	ip := IndexPattern{
+		pattern: pattern,
+		unit:    unitYear,
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return ip, fmt.Errorf("could not load time zone '%s': %s", timezone, err.Error())
+	}
+	ip.location = loc
+
+	rest := pattern
+	for rest != "" {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			ip.parts = append(ip.parts, literal(rest))
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return ip, fmt.Errorf("index pattern '%s' has an unclosed '{'", pattern)
+		}
+		end += start
+		ip.parts = append(ip.parts, literal(rest[:start]))
+
+		format := rest[start+1 : end]
+		if format == "" {
+			return ip, fmt.Errorf("index pattern '%s' has an empty date format", pattern)
+		}
+		for format != "" {
+			matched := false
+			for _, tok := range indexTokens {
+				if strings.HasPrefix(format, tok.token) {
+					ip.parts = append(ip.parts, tok.format)
+					if tok.unit < ip.unit {
+						ip.unit = tok.unit
+					}
+					format = format[len(tok.token):]
+					ip.dynamic = true
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				ip.parts = append(ip.parts, literal(format[:1]))
+				format = format[1:]
+			}
+		}
+		rest = rest[end+1:]
+	}
+
+	return ip, nil
+}
+
+func literal(s string) func(t time.Time) string {
+	return func(time.Time) string { return s }
+}
+
+// Dynamic indicates whether the pattern contains a date format.
+func (ip IndexPattern) Dynamic() bool {
+	return ip.dynamic
+}
+
+func (ip IndexPattern) format(t time.Time) string {
+	var b strings.Builder
+	for _, part := range ip.parts {
+		b.WriteString(part(t))
+	}
+	return b.String()
+}
+
+// truncate returns the beginning of the unit of time 't' lies in.
+func (ip IndexPattern) truncate(t time.Time) time.Time {
+	t = t.In(ip.location)
+	switch ip.unit {
+	case unitHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, ip.location)
+	case unitDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, ip.location)
+	case unitMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, ip.location)
+	}
+	return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, ip.location)
+}
+
+func (ip IndexPattern) next(t time.Time) time.Time {
+	switch ip.unit {
+	case unitHour:
+		return t.Add(time.Hour)
+	case unitDay:
+		return t.AddDate(0, 0, 1)
+	case unitMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(1, 0, 0)
+}
+
+// Expand returns the comma separated list of indices covering the time window
+// from 'from' (inclusive) to 'to' (exclusive). If the pattern does not contain
+// a date format, the pattern is returned as is.
+func (ip IndexPattern) Expand(from, to time.Time) string {
+	if !ip.dynamic {
+		return ip.pattern
+	}
+	if to.Before(from) {
+		from, to = to, from
+	}
+
+	var indices []string
+	seen := make(map[string]bool)
+	for t := ip.truncate(from); ; t = ip.next(t) {
+		index := ip.format(t)
+		if !seen[index] {
+			seen[index] = true
+			indices = append(indices, index)
+		}
+		if !ip.next(t).Before(to) {
+			break
+		}
+	}
+	return strings.Join(indices, ",")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIndexPatternExpand(t *testing.T) {
+	at := func(s string) time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	tests := []struct {
+		pattern  string
+		timezone string
+		from, to string
+		expected string
+	}{
+		{"logstash-*", "UTC", "2020-09-01T10:00:00Z", "2020-09-03T10:00:00Z", "logstash-*"},
+		{"logstash-{yyyy.MM.dd}", "UTC", "2020-09-01T10:00:00Z", "2020-09-01T11:00:00Z", "logstash-2020.09.01"},
+		{"logstash-{yyyy.MM.dd}", "UTC", "2020-09-01T22:00:00Z", "2020-09-03T01:00:00Z", "logstash-2020.09.01,logstash-2020.09.02,logstash-2020.09.03"},
+		// the end is exclusive
+		{"logstash-{yyyy.MM.dd}", "UTC", "2020-09-01T22:00:00Z", "2020-09-02T00:00:00Z", "logstash-2020.09.01"},
+		// reversed windows are accepted
+		{"logstash-{yyyy.MM.dd}", "UTC", "2020-09-02T01:00:00Z", "2020-09-01T22:00:00Z", "logstash-2020.09.01,logstash-2020.09.02"},
+		{"logs-{yyyy.MM}", "UTC", "2020-11-20T00:00:00Z", "2021-01-02T00:00:00Z", "logs-2020.11,logs-2020.12,logs-2021.01"},
+		{"logs-{yy}", "UTC", "2019-12-31T00:00:00Z", "2020-01-01T01:00:00Z", "logs-19,logs-20"},
+		{"logs-{yyyy.MM.dd.HH}", "UTC", "2020-09-01T10:30:00Z", "2020-09-01T12:10:00Z", "logs-2020.09.01.10,logs-2020.09.01.11,logs-2020.09.01.12"},
+		{"{yyyy}-logs-{MM}", "UTC", "2020-09-01T00:00:00Z", "2020-09-02T00:00:00Z", "2020-logs-09"},
+		// indices are named after the local date of the time zone
+		{"logstash-{yyyy.MM.dd}", "Europe/Zurich", "2020-09-01T21:30:00Z", "2020-09-01T23:00:00Z", "logstash-2020.09.01,logstash-2020.09.02"},
+	}
+	for _, test := range tests {
+		ip, err := NewIndexPattern(test.pattern, test.timezone)
+		if err != nil {
+			t.Errorf("%s: %s", test.pattern, err.Error())
+			continue
+		}
+		if out := ip.Expand(at(test.from), at(test.to)); out != test.expected {
+			t.Errorf("%s from %s to %s: expected %s, got %s", test.pattern, test.from, test.to, test.expected, out)
+		}
+	}
+}
+
+func TestIndexPatternErrors(t *testing.T) {
+	tests := []struct {
+		pattern, timezone string
+	}{
+		{"logstash-{yyyy.MM.dd", "UTC"},
+		{"logstash-{}", "UTC"},
+		{"logstash-{yyyy}", "Nowhere/Atlantis"},
+	}
+	for _, test := range tests {
+		if _, err := NewIndexPattern(test.pattern, test.timezone); err == nil {
+			t.Errorf("%s in %s: expected an error", test.pattern, test.timezone)
+		}
+	}
+}
+
+func TestIndexPatternDynamic(t *testing.T) {
+	for pattern, dynamic := range map[string]bool{"logstash-*": false, "logstash-{yyyy}": true, "a,b": false} {
+		ip, err := NewIndexPattern(pattern, "UTC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip.Dynamic() != dynamic {
+			t.Errorf("%s: expected dynamic %v", pattern, dynamic)
+		}
+	}
+}
@@ -53,13 +53,13 @@ func (p Point) String() string {
 	const padding = 1
 
 	var valuesStr []string
-	for key, val := range p.Values {
-		valuesStr = append(valuesStr, fmt.Sprintf("%s: %v", key, val))
+	for _, key := range sortedValueKeys(p.Values) {
+		valuesStr = append(valuesStr, fmt.Sprintf("%s: %v", key, p.Values[key]))
 	}
 
 	var tagsStr []string
-	for key, val := range p.Tags {
-		tagsStr = append(tagsStr, fmt.Sprintf("%s: %s", key, val))
+	for _, key := range sortedKeys(p.Tags) {
+		tagsStr = append(tagsStr, fmt.Sprintf("%s: %s", key, p.Tags[key]))
 	}
 
 	var iterations int
@@ -108,13 +108,14 @@ func (p Point) Copy() Point {
 }
 
 type Influx struct {
-	DB        string
-	Client    client.Client
-	Series    string
-	Indicator string
+	DB              string
+	RetentionPolicy string
+	Client          client.Client
+	Series          string
+	Indicator       string
 }
 
-func NewInflux(host, proto, db, user, pass, series, indicator string, port int) (Influx, error) {
+func NewInflux(host, proto, db, rp, user, pass, series, indicator string, port int) (Influx, error) {
 	i := Influx{}
 	c, err := client.NewHTTPClient(client.HTTPConfig{
 		Addr:     fmt.Sprintf("%s://%s:%d", proto, host, port),
@@ -126,51 +127,34 @@ func NewInflux(host, proto, db, user, pass, series, indicator string, port int)
 	}
 
 	i = Influx{
-		DB:        db,
-		Client:    c,
-		Series:    series,
-		Indicator: indicator,
+		DB:              db,
+		RetentionPolicy: rp,
+		Client:          c,
+		Series:          series,
+		Indicator:       indicator,
 	}
 	return i, nil
 }
 
 const LatestIndicator = "RUMINANT_LAST_RUN"
 
-func (i Influx) GetLatestMarker() (t time.Time, err error) {
-	var res []client.Result
-	q := client.Query{
-		Command:  fmt.Sprintf("SELECT last(%s) FROM %s WHERE ruminant = '%s'", LatestIndicator, i.Series, i.Indicator),
-		Database: i.DB,
-	}
-	response, err := i.Client.Query(q)
-	if err != nil {
-		return
-	} else {
-		if response.Error() != nil {
-			err = response.Error()
-			return
-		}
-		res = response.Results
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("latest Timestamp could not be found")
-			return
-		}
-	}()
-	t, err = time.Parse(time.RFC3339, res[0].Series[0].Values[0][0].(string))
-	if err != nil {
-		return
+func (i Influx) GetLatestMarker() (time.Time, error) {
+	m, err := i.GetMarker()
+	return m.Time, err
+}
+
+// Measurement returns the series to be used in queries, qualified with the
+// retention policy if one is configured.
+func (i Influx) Measurement() string {
+	if i.RetentionPolicy == "" {
+		return i.Series
 	}
-	return
+	return quoteIdent(i.RetentionPolicy) + "." + quoteIdent(i.Series)
 }
 
+// DeleteLatestMarker deletes all markers of the indicator.
 func (i Influx) DeleteLatestMarker() error {
-	q := client.Query{
-		Command:  fmt.Sprintf("DELETE FROM %s WHERE ruminant = '%s'", i.Series, i.Indicator),
-		Database: i.DB,
-	}
-	_, err := i.Client.Query(q)
+	_, err := i.Query(i.DeleteMarkersQuery(time.Time{}))
 	return err
 }
 
@@ -191,24 +175,36 @@ func (i Influx) Query(cmd string) (res []client.Result, err error) {
 	return res, nil
 }
 
-func (i Influx) Write(points []Point) error {
-	if len(points) < 1 {
-		return fmt.Errorf("no points to be written")
+// WriteResult describes the points saved by Write.
+type WriteResult struct {
+	Written int
+	Marker  time.Time
+}
+
+// Write saves the points and a marker timestamp. If 'marker' is zero, the
+// timestamp of the newest point is used as marker. If a point can not be
+// stored, nothing is written.
+func (i Influx) Write(points []Point, marker time.Time) (WriteResult, error) {
+	var res WriteResult
+	if len(points) < 1 && marker.IsZero() {
+		return res, fmt.Errorf("no points to be written")
 	}
+	// points are written with full precision, per event points such as
+	// search hits may be less than a second apart
 	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
-		Database:  i.DB,
-		Precision: "s",
+		Database:        i.DB,
+		RetentionPolicy: i.RetentionPolicy,
+		Precision:       "ns",
 	})
 	if err != nil {
-		return err
+		return res, err
 	}
 
 	var newest time.Time
 	for _, p := range points {
-
-		pt, err := client.NewPoint(i.Series, p.Tags, p.Values, p.Timestamp)
+		pt, err := p.InfluxPoint(i.Series)
 		if err != nil {
-			return err
+			return res, fmt.Errorf("point @ %s: %s", p.Timestamp.Format("2006-01-02 15:04:05"), err.Error())
 		}
 		if p.Timestamp.After(newest) {
 			newest = p.Timestamp
@@ -216,12 +212,17 @@ func (i Influx) Write(points []Point) error {
 		bp.AddPoint(pt)
 	}
 
-	bp.AddPoint(i.LatestMarker(newest, "write"))
+	if marker.IsZero() {
+		marker = newest
+	}
+	bp.AddPoint(i.LatestMarker(marker, "write"))
 
 	if err := i.Client.Write(bp); err != nil {
-		return err
+		return res, err
 	}
-	return nil
+	res.Written = len(bp.Points()) - 1
+	res.Marker = marker
+	return res, nil
 }
 
 func (i Influx) LatestMarker(t time.Time, note string) *client.Point {
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeInflux records the writes received and answers queries with 'query',
+// or with the result of 'answer' if it is set.
+type fakeInflux struct {
+	*httptest.Server
+	writes  []string
+	params  []url.Values
+	queries []string
+	answer  func(q string) string
+}
+
+func newFakeInflux(query string) *fakeInflux {
+	f := &fakeInflux{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/write":
+			b, _ := ioutil.ReadAll(r.Body)
+			f.writes = append(f.writes, string(b))
+			f.params = append(f.params, r.URL.Query())
+			w.WriteHeader(http.StatusNoContent)
+		case "/query":
+			r.ParseForm()
+			f.queries = append(f.queries, r.Form.Get("q"))
+			w.Header().Set("Content-Type", "application/json")
+			if query == "" {
+				query = `{"results": [{"statement_id": 0}]}`
+			}
+			if f.answer != nil {
+				w.Write([]byte(f.answer(r.Form.Get("q"))))
+				return
+			}
+			w.Write([]byte(query))
+		case "/ping":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	return f
+}
+
+func (f *fakeInflux) influx(t *testing.T, rp string) Influx {
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := NewInflux(u.Hostname(), "http", "db", rp, "", "", "s", "ind", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestWriteKeepsSubSecondTimestamps(t *testing.T) {
+	f := newFakeInflux("")
+	defer f.Close()
+	i := f.influx(t, "")
+
+	at := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	points := []Point{
+		{Timestamp: at.Add(123 * time.Millisecond), Tags: map[string]string{"host": "a"}, Values: map[string]interface{}{"n": 1.0}},
+		{Timestamp: at.Add(456 * time.Millisecond), Tags: map[string]string{"host": "a"}, Values: map[string]interface{}{"n": 2.0}},
+	}
+	if _, err := i.Write(points, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.writes) != 1 {
+		t.Fatalf("expected a single write, got %d", len(f.writes))
+	}
+	lines := strings.Split(strings.TrimSpace(f.writes[0]), "\n")
+	expected := []string{
+		"s,host=a n=1 1598954400123000000",
+		"s,host=a n=2 1598954400456000000",
+		`s,ruminant=ind RUMINANT_LAST_RUN="ind: write" 1598954400456000000`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+}
+
+func TestGetLatestMarkerErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		noMarker bool
+	}{
+		{"no marker", `{"results": [{"statement_id": 0}]}`, true},
+		{"query error", `{"results": [{"statement_id": 0, "error": "database not found: db"}]}`, false},
+	}
+	for _, tt := range tests {
+		f := newFakeInflux(tt.answer)
+		_, err := f.influx(t, "").GetLatestMarker()
+		f.Close()
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		// init only writes an initial marker if none was found
+		if _, ok := err.(noMarkerError); ok != tt.noMarker {
+			t.Errorf("%s: expected no marker error %v, got %v", tt.name, tt.noMarker, err)
+		}
+	}
+}
+
+func TestWriteFailsTheBatch(t *testing.T) {
+	at := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	valid := Point{Timestamp: at, Tags: map[string]string{"host": "a"}, Values: map[string]interface{}{"n": 1.0}}
+	tests := []struct {
+		name  string
+		point Point
+		err   string
+	}{
+		{
+			name:  "no values",
+			point: Point{Timestamp: at.Add(time.Second), Tags: map[string]string{"host": "b"}, Values: map[string]interface{}{"n": nil}},
+			err:   "point @ 2020-09-01 10:00:01: point without fields is unsupported",
+		},
+		{
+			name:  "infinite",
+			point: Point{Timestamp: at.Add(time.Second), Tags: map[string]string{"host": "b"}, Values: map[string]interface{}{"n": math.Inf(1)}},
+			err:   "point @ 2020-09-01 10:00:01: +Inf is an unsupported value for field n",
+		},
+	}
+	for _, test := range tests {
+		f := newFakeInflux("")
+		i := f.influx(t, "")
+		res, err := i.Write([]Point{valid, test.point}, time.Time{})
+		f.Close()
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+		}
+		if res.Written != 0 || !res.Marker.IsZero() {
+			t.Errorf("%s: expected nothing to be written, got %+v", test.name, res)
+		}
+		if len(f.writes) != 0 {
+			t.Errorf("%s: expected no write, got %q", test.name, f.writes)
+		}
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	f := newFakeInflux("")
+	defer f.Close()
+	i := f.influx(t, "www_90d")
+
+	at := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	points := []Point{
+		{Timestamp: at.Add(time.Hour), Values: map[string]interface{}{"n": 1.0}},
+		{Timestamp: at, Values: map[string]interface{}{"n": 2.0}},
+	}
+	tests := []struct {
+		name   string
+		points []Point
+		marker time.Time
+		res    WriteResult
+		err    string
+	}{
+		{name: "newest point", points: points, res: WriteResult{Written: 2, Marker: at.Add(time.Hour)}},
+		{name: "marker given", points: points, marker: at.Add(2 * time.Hour), res: WriteResult{Written: 2, Marker: at.Add(2 * time.Hour)}},
+		{name: "marker only", marker: at, res: WriteResult{Marker: at}},
+		{name: "nothing", err: "no points to be written"},
+	}
+	for _, test := range tests {
+		res, err := i.Write(test.points, test.marker)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if res.Written != test.res.Written || !res.Marker.Equal(test.res.Marker) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.res, res)
+		}
+	}
+	for _, p := range f.params {
+		if p.Get("rp") != "www_90d" || p.Get("precision") != "ns" {
+			t.Errorf("unexpected write parameters %v", p)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "partial write: field type conflict"}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	i, err := NewInflux(u.Hostname(), "http", "db", "", "", "", "s", "ind", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := i.Write([]Point{{Timestamp: time.Now(), Values: map[string]interface{}{"n": 1.0}}}, time.Time{})
+	if err == nil || !strings.Contains(err.Error(), "field type conflict") {
+		t.Errorf("expected the error of InfluxDB, got %v", err)
+	}
+	if res.Written != 0 {
+		t.Errorf("expected nothing to be written, got %+v", res)
+	}
+}
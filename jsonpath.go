@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathExpression is a compiled JSONPath expression. The subset supported
+// consists of the root '$' or current element '@', child keys in dot or
+// bracket notation, array indexes, slices, unions, the wildcard '*' and
+// recursive descent '..'. Filter and script expressions are not supported.
+//
+// A path selecting at most one node, ie. a path consisting only of keys and
+// single indexes, returns the node itself or nil if it does not exist. All
+// other paths return the list of nodes selected.
+type jsonPathExpression struct {
+	steps    []jsonPathStep
+	definite bool
+}
+
+type jsonPathStep struct {
+	// descend applies the step to the node and all its descendants
+	descend  bool
+	wildcard bool
+	keys     []string
+	indexes  []int
+	slice    bool
+	start    *int
+	end      *int
+}
+
+func compileJSONPath(src string) (Expression, error) {
+	p := &jsonPathParser{src: strings.TrimSpace(src)}
+	steps, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	e := &jsonPathExpression{steps: steps, definite: true}
+	for _, s := range steps {
+		if s.descend || s.wildcard || s.slice || len(s.keys)+len(s.indexes) > 1 {
+			e.definite = false
+		}
+	}
+	return e, nil
+}
+
+func (e *jsonPathExpression) Eval(doc interface{}) (interface{}, error) {
+	nodes := []interface{}{doc}
+	for _, s := range e.steps {
+		var next []interface{}
+		for _, n := range nodes {
+			if s.descend {
+				for _, d := range descendants(n, nil) {
+					next = s.apply(d, next)
+				}
+			} else {
+				next = s.apply(n, next)
+			}
+		}
+		nodes = next
+	}
+	if e.definite {
+		if len(nodes) < 1 {
+			return nil, nil
+		}
+		return nodes[0], nil
+	}
+	if nodes == nil {
+		nodes = []interface{}{}
+	}
+	return nodes, nil
+}
+
+// apply appends the children of 'n' selected by the step to 'out'.
+func (s jsonPathStep) apply(n interface{}, out []interface{}) []interface{} {
+	switch v := n.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			for _, key := range keysOf(v) {
+				out = append(out, v[key])
+			}
+		}
+		for _, key := range s.keys {
+			if child, ok := v[key]; ok {
+				out = append(out, child)
+			}
+		}
+	case []interface{}:
+		if s.wildcard {
+			out = append(out, v...)
+		}
+		for _, i := range s.indexes {
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				out = append(out, v[i])
+			}
+		}
+		if s.slice {
+			start, end := 0, len(v)
+			if s.start != nil {
+				start = clampIndex(*s.start, len(v))
+			}
+			if s.end != nil {
+				end = clampIndex(*s.end, len(v))
+			}
+			for i := start; i < end; i++ {
+				out = append(out, v[i])
+			}
+		}
+	}
+	return out
+}
+
+func clampIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
+
+// descendants appends a node and all nodes nested in it to 'out'. Keys of
+// objects are visited in sorted order to return the nodes in a stable order.
+func descendants(n interface{}, out []interface{}) []interface{} {
+	out = append(out, n)
+	switch v := n.(type) {
+	case map[string]interface{}:
+		for _, key := range keysOf(v) {
+			out = descendants(v[key], out)
+		}
+	case []interface{}:
+		for _, child := range v {
+			out = descendants(child, out)
+		}
+	}
+	return out
+}
+
+type jsonPathParser struct {
+	src string
+	pos int
+}
+
+func (p *jsonPathParser) parse() ([]jsonPathStep, error) {
+	if p.src == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	switch p.src[0] {
+	case '$', '@':
+		p.pos++
+	case '.', '[':
+		// the root is implied
+	default:
+		return nil, fmt.Errorf("path must start with '$'")
+	}
+
+	var steps []jsonPathStep
+	for p.pos < len(p.src) {
+		var s jsonPathStep
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], ".."):
+			p.pos += 2
+			s.descend = true
+			if p.pos < len(p.src) && p.src[p.pos] == '[' {
+				if err := p.bracket(&s); err != nil {
+					return nil, err
+				}
+			} else if err := p.name(&s); err != nil {
+				return nil, err
+			}
+		case p.src[p.pos] == '.':
+			p.pos++
+			if err := p.name(&s); err != nil {
+				return nil, err
+			}
+		case p.src[p.pos] == '[':
+			if err := p.bracket(&s); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected '%c' at position %d", p.src[p.pos], p.pos)
+		}
+		steps = append(steps, s)
+	}
+	return steps, nil
+}
+
+// name reads a key or wildcard in dot notation.
+func (p *jsonPathParser) name(s *jsonPathStep) error {
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != '.' && p.src[p.pos] != '[' {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+	switch name {
+	case "":
+		return fmt.Errorf("missing key at position %d", start)
+	case "*":
+		s.wildcard = true
+	default:
+		s.keys = []string{name}
+	}
+	return nil
+}
+
+// bracket reads a wildcard, a union of keys or indexes or a slice in bracket
+// notation.
+func (p *jsonPathParser) bracket(s *jsonPathStep) error {
+	start := p.pos
+	p.pos++
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return fmt.Errorf("unterminated '[' at position %d", start)
+		}
+		switch c := p.src[p.pos]; {
+		case c == '*':
+			p.pos++
+			s.wildcard = true
+		case c == '\'' || c == '"':
+			key, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			s.keys = append(s.keys, key)
+		case c == '?' || c == '(':
+			return fmt.Errorf("filter and script expressions are not supported")
+		default:
+			if err := p.index(s); err != nil {
+				return err
+			}
+		}
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return fmt.Errorf("unterminated '[' at position %d", start)
+		}
+		switch p.src[p.pos] {
+		case ']':
+			p.pos++
+			if s.slice && (s.wildcard || len(s.keys)+len(s.indexes) > 0) {
+				return fmt.Errorf("slices cannot be combined with other selectors at position %d", start)
+			}
+			return nil
+		case ',':
+			p.pos++
+		default:
+			return fmt.Errorf("unexpected '%c' at position %d", p.src[p.pos], p.pos)
+		}
+	}
+}
+
+// index reads an index or a slice 'start:end'.
+func (p *jsonPathParser) index(s *jsonPathStep) error {
+	p.skipSpace()
+	start := p.pos
+	first, err := p.number()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != ':' {
+		if first == nil {
+			return fmt.Errorf("expected index at position %d", p.pos)
+		}
+		s.indexes = append(s.indexes, *first)
+		return nil
+	}
+	p.pos++
+	second, err := p.number()
+	if err != nil {
+		return err
+	}
+	if s.slice {
+		return fmt.Errorf("only one slice is allowed at position %d", start)
+	}
+	s.slice = true
+	s.start, s.end = first, second
+	return nil
+}
+
+// number reads an optional integer.
+func (p *jsonPathParser) number() (*int, error) {
+	p.skipSpace()
+	start := p.pos
+	if p.pos < len(p.src) && p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		return nil, fmt.Errorf("invalid index '%s' at position %d", p.src[start:p.pos], start)
+	}
+	return &n, nil
+}
+
+// quoted reads a key in single or double quotes. A backslash escapes the
+// character following it.
+func (p *jsonPathParser) quoted() (string, error) {
+	quote := p.src[p.pos]
+	start := p.pos
+	p.pos++
+	var key strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && p.pos < len(p.src):
+			key.WriteByte(p.src[p.pos])
+			p.pos++
+		case c == quote:
+			return key.String(), nil
+		default:
+			key.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string at position %d", start)
+}
+
+func (p *jsonPathParser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const jsonPathDoc = `{
+	"store": {
+		"book": [
+			{"title": "a", "price": 8},
+			{"title": "b", "price": 12},
+			{"title": "c", "price": 9, "isbn": "x"}
+		],
+		"bicycle": {"price": 20},
+		"with space": 1,
+		"it's": 2,
+		"95.0": 3
+	},
+	"list": [0, 1, 2, 3, 4]
+}`
+
+func TestJSONPath(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(jsonPathDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src    string
+		result string
+	}{
+		// definite paths return the node or null
+		{"$", jsonPathDoc},
+		{"$.store.bicycle.price", `20`},
+		{"@.store.bicycle.price", `20`},
+		{".store.bicycle.price", `20`},
+		{"$['store']['bicycle']", `{"price": 20}`},
+		{`$.store["with space"]`, `1`},
+		{`$.store['it\'s']`, `2`},
+		{`$.store['95.0']`, `3`},
+		{"$.store.missing", `null`},
+		{"$.list[1]", `1`},
+		{"$.list[-1]", `4`},
+		{"$.list[-6]", `null`},
+		{"$.list[5]", `null`},
+		{"$.store.book[0].title", `"a"`},
+		{"$[ 'list' ][ 2 ]", `2`},
+		// all other paths return a list
+		{"$.list[1:3]", `[1, 2]`},
+		{"$.list[:2]", `[0, 1]`},
+		{"$.list[-2:]", `[3, 4]`},
+		{"$.list[3:1]", `[]`},
+		{"$.list[:]", `[0, 1, 2, 3, 4]`},
+		{"$.list[0,2,-1]", `[0, 2, 4]`},
+		{"$.list[0,9]", `[0]`},
+		{"$.store['bicycle','missing','with space']", `[{"price": 20}, 1]`},
+		{"$.store.book[*].title", `["a", "b", "c"]`},
+		{"$.store.book.*.price", `[8, 12, 9]`},
+		{"$.store.*.price", `[20]`},
+		{"$.store..price", `[20, 8, 12, 9]`},
+		{"$..isbn", `["x"]`},
+		{"$..book[1].title", `["b"]`},
+		{"$..['title']", `["a", "b", "c"]`},
+		{"$..missing", `[]`},
+		{"$.list.*", `[0, 1, 2, 3, 4]`},
+	}
+	for _, test := range tests {
+		e, err := CompileExpression(LangJSONPath, test.src)
+		if err != nil {
+			t.Errorf("%s: %s", test.src, err.Error())
+			continue
+		}
+		out, err := e.Eval(doc)
+		if err != nil {
+			t.Errorf("%s: %s", test.src, err.Error())
+			continue
+		}
+		var expected interface{}
+		if err := json.Unmarshal([]byte(test.result), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, expected) {
+			b, _ := json.Marshal(out)
+			t.Errorf("%s: expected %s, got %s", test.src, test.result, string(b))
+		}
+	}
+}
+
+func TestJSONPathErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"", "empty path"},
+		{"store.book", "path must start with '$'"},
+		{"$store", "unexpected 's' at position 1"},
+		{"$.store.", "missing key at position 8"},
+		{"$..", "missing key at position 3"},
+		{"$.list[1", "unterminated '[' at position 6"},
+		{"$.list[", "unterminated '[' at position 6"},
+		{"$.list[1;2]", "unexpected ';' at position 8"},
+		{"$.list[]", "expected index at position 7"},
+		{"$.list[-]", "invalid index '-' at position 7"},
+		{"$.store['a]", "unterminated string at position 8"},
+		{"$.list[?(@.price > 10)]", "filter and script expressions are not supported"},
+		{"$.list[(@.length-1)]", "filter and script expressions are not supported"},
+		{"$.list[1:2,3]", "slices cannot be combined with other selectors at position 6"},
+		{"$.list[1:2,3:4]", "only one slice is allowed at position 11"},
+	}
+	for _, test := range tests {
+		_, err := CompileExpression(LangJSONPath, test.src)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: expected error '%s', got %v", test.src, test.err, err)
+		}
+	}
+}
+
+func TestJMESPath(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(jsonPathDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+	e, err := CompileExpression(LangJMESPath, `store."95.0"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := e.Eval(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != 3.0 {
+		t.Errorf("expected 3, got %v", out)
+	}
+	if _, err := CompileExpression(LangJMESPath, "store.["); err == nil {
+		t.Errorf("expected an error for an invalid expression")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// errInterrupt is returned by ReadLine if the input is aborted via ctrl-c.
+var errInterrupt = errors.New("interrupted")
+
+// LineReader reads lines from stdin. If stdin is a terminal, the line can be
+// edited, previous lines are recalled using the up and down keys and tab
+// completes the line using the 'Complete' callback.
+type LineReader struct {
+	// Complete returns the candidates completing a line.
+	Complete func(line string) []string
+
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int
+	tty     bool
+	history []string
+}
+
+func NewLineReader() *LineReader {
+	fd := int(os.Stdin.Fd())
+	return &LineReader{
+		in:  bufio.NewReader(os.Stdin),
+		out: os.Stdout,
+		fd:  fd,
+		tty: isTerminal(fd),
+	}
+}
+
+// ReadLine prints the prompt and reads a line. The prompt is only printed if
+// stdin is a terminal. io.EOF is returned at the end
+// of the input or if ctrl-d is pressed on an empty line.
+func (r *LineReader) ReadLine(prompt string) (string, error) {
+	if !r.tty {
+		line, err := r.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	fmt.Fprint(r.out, prompt)
+	state, err := makeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restoreTerm(r.fd, state)
+
+	line := ""
+	pos := len(r.history)
+	redraw := func() {
+		fmt.Fprintf(r.out, "\r\x1b[K%s%s", prompt, line)
+	}
+	for {
+		b, err := r.in.ReadByte()
+		if err != nil {
+			return line, err
+		}
+		switch b {
+		case 3: // ctrl-c
+			fmt.Fprint(r.out, "^C\r\n")
+			return "", errInterrupt
+		case 4: // ctrl-d
+			if line == "" {
+				fmt.Fprint(r.out, "\r\n")
+				return "", io.EOF
+			}
+		case '\r', '\n':
+			fmt.Fprint(r.out, "\r\n")
+			if strings.TrimSpace(line) != "" {
+				r.history = append(r.history, line)
+			}
+			return line, nil
+		case 127, 8: // backspace
+			if line != "" {
+				_, size := utf8.DecodeLastRuneInString(line)
+				line = line[:len(line)-size]
+				redraw()
+			}
+		case 21: // ctrl-u
+			line = ""
+			redraw()
+		case '\t':
+			if r.Complete == nil {
+				continue
+			}
+			candidates := r.Complete(line)
+			if len(candidates) < 1 {
+				continue
+			}
+			prefix := commonPrefix(candidates)
+			if len(candidates) > 1 && len(prefix) <= len(line) {
+				fmt.Fprintf(r.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+			}
+			if len(prefix) > len(line) {
+				line = prefix
+			}
+			redraw()
+		case 27: // escape sequences, only the up and down keys are supported
+			if next, _ := r.in.ReadByte(); next != '[' {
+				continue
+			}
+			key, _ := r.in.ReadByte()
+			for k := key; k >= '0' && k <= '9'; k, _ = r.in.ReadByte() {
+				// skip sequences such as 'ESC [ 3 ~'
+			}
+			switch {
+			case key == 'A' && pos > 0:
+				pos--
+				line = r.history[pos]
+			case key == 'B' && pos < len(r.history):
+				pos++
+				line = ""
+				if pos < len(r.history) {
+					line = r.history[pos]
+				}
+			}
+			redraw()
+		default:
+			if b >= 32 {
+				line += string([]byte{b})
+				r.out.Write([]byte{b})
+			}
+		}
+	}
+}
+
+func commonPrefix(list []string) string {
+	prefix := list[0]
+	for _, s := range list[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
+)
+
+// InfluxPoint converts the point into a point of the InfluxDB client, which
+// is what is written by Influx.Write. Values that are nil are left out,
+// values that are neither numbers, booleans nor strings are written as JSON
+// strings. Points without values and values InfluxDB can not store, such as
+// NaN or infinity, are rejected.
+func (p Point) InfluxPoint(series string) (*client.Point, error) {
+	fields := make(map[string]interface{}, len(p.Values))
+	for key, value := range p.Values {
+		switch v := value.(type) {
+		case nil:
+			continue
+		case float64:
+			if math.IsInf(v, 0) {
+				return nil, fmt.Errorf("%v is an unsupported value for field %s", v, key)
+			}
+		case float32:
+			if math.IsInf(float64(v), 0) {
+				return nil, fmt.Errorf("%v is an unsupported value for field %s", v, key)
+			}
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, bool, string:
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("could not format field %s: %s", key, err.Error())
+			}
+			value = string(b)
+		}
+		fields[key] = value
+	}
+	return client.NewPoint(series, p.Tags, fields, p.Timestamp)
+}
+
+// LineProtocol formats a point in the InfluxDB line protocol exactly as it
+// is written by Influx.Write. Tags and values are sorted by key, the
+// timestamp is written in nanoseconds and omitted if it is zero.
+func (p Point) LineProtocol(series string) (string, error) {
+	pt, err := p.InfluxPoint(series)
+	if err != nil {
+		return "", err
+	}
+	return pt.String(), nil
+}
+
+// ParseLineProtocol reads points written in the InfluxDB line protocol with
+// timestamps in nanoseconds.
+func ParseLineProtocol(in []byte) ([]Point, error) {
+	parsed, err := models.ParsePointsWithPrecision(in, time.Time{}, "n")
+	if err != nil {
+		return nil, err
+	}
+	var points []Point
+	for _, pp := range parsed {
+		p := Point{
+			Timestamp: pp.Time(),
+			Tags:      make(map[string]string),
+			Values:    make(map[string]interface{}),
+		}
+		for _, tag := range pp.Tags() {
+			p.Tags[string(tag.Key)] = string(tag.Value)
+		}
+		fields, err := pp.Fields()
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fields {
+			p.Values[key] = value
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedValueKeys(m map[string]interface{}) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
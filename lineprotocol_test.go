@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxPoint(t *testing.T) {
+	ts := time.Date(2020, 3, 1, 12, 0, 0, 500, time.UTC)
+	tests := []struct {
+		point Point
+		line  string
+		err   string
+	}{
+		{
+			Point{Timestamp: ts, Tags: map[string]string{"host": "a", "dc": "x"}, Values: map[string]interface{}{"v": 1.5, "n": 2}},
+			"s,dc=x,host=a n=2i,v=1.5 1583064000000000500",
+			"",
+		},
+		{
+			Point{Tags: map[string]string{"host name": "a,b=c", "empty": ""}, Values: map[string]interface{}{"msg": `say "hi"\`, "ok": true}},
+			`s,host\ name=a\,b\=c msg="say \"hi\"\\",ok=true`,
+			"",
+		},
+		{
+			Point{Timestamp: ts, Values: map[string]interface{}{"v": 1.0, "missing": nil, "list": []interface{}{1.0, "a"}}},
+			`s list="[1,\"a\"]",v=1 1583064000000000500`,
+			"",
+		},
+		{Point{Values: map[string]interface{}{"v": math.NaN()}}, "", "NaN is an unsupported value for field v"},
+		{Point{Values: map[string]interface{}{"v": math.Inf(1)}}, "", "+Inf is an unsupported value for field v"},
+		{Point{Values: map[string]interface{}{"v": math.Inf(-1)}}, "", "-Inf is an unsupported value for field v"},
+		{Point{Values: map[string]interface{}{"v": nil}}, "", "point without fields is unsupported"},
+	}
+	for _, test := range tests {
+		pt, err := test.point.InfluxPoint("s")
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v: expected error '%s', got %v", test.point, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %s", test.point, err.Error())
+			continue
+		}
+		if line := pt.String(); line != test.line {
+			t.Errorf("expected %s, got %s", test.line, line)
+		}
+	}
+}
+
+func TestParseLineProtocol(t *testing.T) {
+	in := `s,host=a msg="x y",n=2i,ok=true,v=1.5 1583064000000000500
+s v=1 1583064000000000000
+`
+	points, err := ParseLineProtocol([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Point{
+		{
+			Timestamp: time.Unix(0, 1583064000000000500),
+			Tags:      map[string]string{"host": "a"},
+			Values:    map[string]interface{}{"n": int64(2), "v": 1.5, "msg": "x y", "ok": true},
+		},
+		{
+			Timestamp: time.Unix(0, 1583064000000000000),
+			Tags:      map[string]string{},
+			Values:    map[string]interface{}{"v": 1.0},
+		},
+	}
+	if len(points) != len(expected) {
+		t.Fatalf("expected %d points, got %d", len(expected), len(points))
+	}
+	for n, p := range points {
+		e := expected[n]
+		if !p.Timestamp.Equal(e.Timestamp) || !reflect.DeepEqual(p.Tags, e.Tags) || !reflect.DeepEqual(p.Values, e.Values) {
+			t.Errorf("expected %v, got %v", e, p)
+		}
+		// lines written are read back unchanged
+		pt, err := p.InfluxPoint("s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line := pt.String(); !strings.Contains(in, line+"\n") {
+			t.Errorf("%s was not read back unchanged", line)
+		}
+	}
+
+	if _, err := ParseLineProtocol([]byte("s v= 1\n")); err == nil {
+		t.Errorf("expected an error for invalid line protocol")
+	}
+}
+
+func TestLineProtocol(t *testing.T) {
+	ts := time.Date(2020, 3, 1, 12, 0, 0, 500, time.UTC)
+	tests := []struct {
+		point Point
+		line  string
+		err   string
+	}{
+		{point: Point{Timestamp: ts, Tags: map[string]string{"host": "a"}, Values: map[string]interface{}{"v": 1.5, "n": 2}}, line: "s,host=a n=2i,v=1.5 1583064000000000500"},
+		{point: Point{Values: map[string]interface{}{"v": 1e21}}, line: "s v=1000000000000000000000"},
+		{point: Point{Values: map[string]interface{}{"v": math.NaN()}}, err: "NaN is an unsupported value for field v"},
+		{point: Point{Values: map[string]interface{}{"v": nil}}, err: "point without fields is unsupported"},
+	}
+	for _, test := range tests {
+		line, err := test.point.LineProtocol("s")
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v: expected error '%s', got %v", test.point, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %s", test.point, err.Error())
+			continue
+		}
+		if line != test.line {
+			t.Errorf("expected %s, got %s", test.line, line)
+		}
+		// the line is what the client writes
+		pt, err := test.point.InfluxPoint("s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written := pt.PrecisionString("ns"); written != line {
+			t.Errorf("expected %s to be written, got %s", line, written)
+		}
+	}
+}
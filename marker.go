@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/client/v2"
+)
+
+// Marker is a marker timestamp written by a run of a configuration.
+type Marker struct {
+	Indicator string
+	Time      time.Time
+	Note      string
+	// RetentionPolicy is the policy the marker was read from, empty for the
+	// default policy of the database.
+	RetentionPolicy string
+}
+
+// quoteString quotes a string literal in InfluxQL.
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// MarkerQuery returns the query reading the latest marker of the indicator.
+func (i Influx) MarkerQuery() string {
+	return fmt.Sprintf("SELECT last(%s) FROM %s WHERE ruminant = %s", LatestIndicator, i.Measurement(), quoteString(i.Indicator))
+}
+
+// ListMarkersQuery returns the query reading the latest marker of every
+// indicator found in the series.
+func (i Influx) ListMarkersQuery() string {
+	return fmt.Sprintf("SELECT last(%s) FROM %s GROUP BY ruminant", LatestIndicator, i.Measurement())
+}
+
+// DeleteMarkersQuery returns the statement deleting the markers of the
+// indicator. If 'after' is not zero, only markers after that time are
+// deleted. DELETE does not support retention policies, the markers are
+// deleted in all of them.
+func (i Influx) DeleteMarkersQuery(after time.Time) string {
+	q := fmt.Sprintf("DELETE FROM %s WHERE ruminant = %s", quoteIdent(i.Series), quoteString(i.Indicator))
+	if !after.IsZero() {
+		q += " AND time > " + InfluxTime(after)
+	}
+	return q
+}
+
+// MarkerWrite describes how a marker is written: the endpoint and the point
+// in line protocol.
+func (i Influx) MarkerWrite(t time.Time, note string) string {
+	endpoint := "POST /write?db=" + i.DB
+	if i.RetentionPolicy != "" {
+		endpoint += "&rp=" + i.RetentionPolicy
+	}
+	return endpoint + "&precision=s\n" + i.LatestMarker(t, note).PrecisionString("s")
+}
+
+// noMarkerError is returned by GetMarker if the indicator has no marker yet.
+type noMarkerError struct {
+	indicator string
+}
+
+func (e noMarkerError) Error() string {
+	return fmt.Sprintf("no marker found for indicator '%s'", e.indicator)
+}
+
+// GetMarker reads the latest marker of the indicator. Installations set up
+// before a retention policy was configured have their marker in the default
+// policy of the database, it is read from there if the configured policy
+// holds none.
+func (i Influx) GetMarker() (Marker, error) {
+	res, err := i.Query(i.MarkerQuery())
+	if err != nil {
+		return Marker{}, err
+	}
+	markers, err := i.readMarkers(res)
+	if err != nil {
+		return Marker{}, err
+	}
+	if len(markers) < 1 {
+		if i.RetentionPolicy != "" {
+			fallback := i
+			fallback.RetentionPolicy = ""
+			return fallback.GetMarker()
+		}
+		return Marker{}, noMarkerError{i.Indicator}
+	}
+	return markers[0], nil
+}
+
+// MigrateMarker copies a marker read from another retention policy into the
+// configured one. It reports whether the marker was copied.
+func (i Influx) MigrateMarker(m Marker) (bool, error) {
+	if m.RetentionPolicy == i.RetentionPolicy {
+		return false, nil
+	}
+	return true, i.SetMarker(m.Time, m.Note)
+}
+
+// ListMarkers reads the latest marker of every indicator.
+func (i Influx) ListMarkers() ([]Marker, error) {
+	res, err := i.Query(i.ListMarkersQuery())
+	if err != nil {
+		return nil, err
+	}
+	return i.readMarkers(res)
+}
+
+func (i Influx) readMarkers(res []client.Result) ([]Marker, error) {
+	var markers []Marker
+	for _, r := range res {
+		for _, s := range r.Series {
+			indicator, ok := s.Tags["ruminant"]
+			if !ok {
+				indicator = i.Indicator
+			}
+			for _, row := range s.Values {
+				if len(row) < 2 {
+					continue
+				}
+				ts, _ := row[0].(string)
+				t, err := time.Parse(time.RFC3339Nano, ts)
+				if err != nil {
+					return nil, fmt.Errorf("marker time could not be read: %s", err.Error())
+				}
+				note, _ := row[1].(string)
+				markers = append(markers, Marker{
+					Indicator:       indicator,
+					Time:            t,
+					Note:            strings.TrimPrefix(note, indicator+": "),
+					RetentionPolicy: i.RetentionPolicy,
+				})
+			}
+		}
+	}
+	return markers, nil
+}
+
+// SetMarker writes a marker. Since the latest marker is the one used, newer
+// markers are deleted first to allow moving the marker back in time.
+func (i Influx) SetMarker(t time.Time, note string) error {
+	if _, err := i.Query(i.DeleteMarkersQuery(t)); err != nil {
+		return err
+	}
+	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
+		Database:        i.DB,
+		RetentionPolicy: i.RetentionPolicy,
+		Precision:       "s",
+	})
+	if err != nil {
+		return err
+	}
+	bp.AddPoint(i.LatestMarker(t, note))
+	return i.Client.Write(bp)
+}
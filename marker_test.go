@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const markerResult = `{"results": [{"statement_id": 0, "series": [{"name": "s", "columns": ["time", "last"], "values": [["2020-09-01T10:00:00Z", "ind: write"]]}]}]}`
+
+func TestGetMarkerFallsBackToDefaultPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		rp      string
+		stored  string
+		queries []string
+		policy  string
+		err     bool
+	}{
+		{
+			name:    "in policy",
+			rp:      "www_90d",
+			stored:  "www_90d",
+			queries: []string{`SELECT last(RUMINANT_LAST_RUN) FROM "www_90d"."s" WHERE ruminant = 'ind'`},
+			policy:  "www_90d",
+		},
+		{
+			name: "in default policy",
+			rp:   "www_90d",
+			queries: []string{
+				`SELECT last(RUMINANT_LAST_RUN) FROM "www_90d"."s" WHERE ruminant = 'ind'`,
+				`SELECT last(RUMINANT_LAST_RUN) FROM s WHERE ruminant = 'ind'`,
+			},
+		},
+		{
+			name:    "no policy",
+			queries: []string{`SELECT last(RUMINANT_LAST_RUN) FROM s WHERE ruminant = 'ind'`},
+		},
+	}
+	for _, test := range tests {
+		f := newFakeInflux("")
+		stored := test.stored
+		f.answer = func(q string) string {
+			// the marker is only found in the policy it is stored in
+			if strings.Contains(q, `"www_90d".`) == (stored != "") {
+				return markerResult
+			}
+			return `{"results": [{"statement_id": 0}]}`
+		}
+		i := f.influx(t, test.rp)
+		m, err := i.GetMarker()
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if m.RetentionPolicy != test.policy {
+			t.Errorf("%s: expected the marker from policy %q, got %q", test.name, test.policy, m.RetentionPolicy)
+		}
+		if !m.Time.Equal(time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)) || m.Note != "write" {
+			t.Errorf("%s: unexpected marker %+v", test.name, m)
+		}
+		if strings.Join(f.queries, "\n") != strings.Join(test.queries, "\n") {
+			t.Errorf("%s: expected queries %q, got %q", test.name, test.queries, f.queries)
+		}
+	}
+}
+
+func TestGetMarkerMissing(t *testing.T) {
+	f := newFakeInflux("")
+	defer f.Close()
+	i := f.influx(t, "www_90d")
+	if _, err := i.GetMarker(); err == nil || err.Error() != "no marker found for indicator 'ind'" {
+		t.Errorf("expected a missing marker, got %v", err)
+	}
+	if len(f.queries) != 2 {
+		t.Errorf("expected the policy and the default policy to be queried, got %q", f.queries)
+	}
+}
+
+func TestMigrateMarker(t *testing.T) {
+	at := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		rp       string
+		from     string
+		migrated bool
+	}{
+		{name: "from default policy", rp: "www_90d", migrated: true},
+		{name: "in policy", rp: "www_90d", from: "www_90d"},
+		{name: "no policy"},
+	}
+	for _, test := range tests {
+		f := newFakeInflux("")
+		i := f.influx(t, test.rp)
+		migrated, err := i.MigrateMarker(Marker{Indicator: "ind", Time: at, Note: "write", RetentionPolicy: test.from})
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if migrated != test.migrated {
+			t.Errorf("%s: expected migrated %t, got %t", test.name, test.migrated, migrated)
+		}
+		if !test.migrated {
+			if len(f.writes) != 0 {
+				t.Errorf("%s: expected no write, got %q", test.name, f.writes)
+			}
+			continue
+		}
+		if len(f.writes) != 1 || f.params[0].Get("rp") != test.rp {
+			t.Errorf("%s: expected a write to %s, got %q %v", test.name, test.rp, f.writes, f.params)
+			continue
+		}
+		if expected := `s,ruminant=ind RUMINANT_LAST_RUN="ind: write" 1598954400`; strings.TrimSpace(f.writes[0]) != expected {
+			t.Errorf("%s: expected %s, got %s", test.name, expected, f.writes[0])
+		}
+	}
+}
+
+func TestQuoteString(t *testing.T) {
+	tests := map[string]string{
+		"ind":         `'ind'`,
+		"it's":        `'it\'s'`,
+		`back\slash`:  `'back\\slash'`,
+		`both\'quote`: `'both\\\'quote'`,
+	}
+	for in, expected := range tests {
+		if got := quoteString(in); got != expected {
+			t.Errorf("%s: expected %s, got %s", in, expected, got)
+		}
+	}
+}
+
+func TestMarkerQueries(t *testing.T) {
+	at := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		rp     string
+		marker string
+		list   string
+		delete string
+		after  string
+		write  string
+	}{
+		{
+			name:   "default policy",
+			marker: `SELECT last(RUMINANT_LAST_RUN) FROM s WHERE ruminant = 'ind'`,
+			list:   `SELECT last(RUMINANT_LAST_RUN) FROM s GROUP BY ruminant`,
+			delete: `DELETE FROM "s" WHERE ruminant = 'ind'`,
+			after:  `DELETE FROM "s" WHERE ruminant = 'ind' AND time > '2020-09-01T10:00:00Z'`,
+			write:  "POST /write?db=db&precision=s\ns,ruminant=ind RUMINANT_LAST_RUN=\"ind: set\" 1598954400",
+		},
+		{
+			name:   "retention policy",
+			rp:     "www_90d",
+			marker: `SELECT last(RUMINANT_LAST_RUN) FROM "www_90d"."s" WHERE ruminant = 'ind'`,
+			list:   `SELECT last(RUMINANT_LAST_RUN) FROM "www_90d"."s" GROUP BY ruminant`,
+			delete: `DELETE FROM "s" WHERE ruminant = 'ind'`,
+			after:  `DELETE FROM "s" WHERE ruminant = 'ind' AND time > '2020-09-01T10:00:00Z'`,
+			write:  "POST /write?db=db&rp=www_90d&precision=s\ns,ruminant=ind RUMINANT_LAST_RUN=\"ind: set\" 1598954400",
+		},
+	}
+	for _, test := range tests {
+		i := Influx{DB: "db", RetentionPolicy: test.rp, Series: "s", Indicator: "ind"}
+		if q := i.MarkerQuery(); q != test.marker {
+			t.Errorf("%s: expected marker query %s, got %s", test.name, test.marker, q)
+		}
+		if q := i.ListMarkersQuery(); q != test.list {
+			t.Errorf("%s: expected list query %s, got %s", test.name, test.list, q)
+		}
+		if q := i.DeleteMarkersQuery(time.Time{}); q != test.delete {
+			t.Errorf("%s: expected delete query %s, got %s", test.name, test.delete, q)
+		}
+		if q := i.DeleteMarkersQuery(at); q != test.after {
+			t.Errorf("%s: expected delete query %s, got %s", test.name, test.after, q)
+		}
+		if q := i.MarkerWrite(at, "set"); q != test.write {
+			t.Errorf("%s: expected write %q, got %q", test.name, test.write, q)
+		}
+	}
+}
+
+func TestListMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   string
+		expected []Marker
+		err      string
+	}{
+		{
+			name:   "grouped",
+			result: `{"results": [{"statement_id": 0, "series": [{"name": "s", "tags": {"ruminant": "a"}, "columns": ["time", "last"], "values": [["2020-09-01T10:00:00Z", "a: write"]]}, {"name": "s", "tags": {"ruminant": "b"}, "columns": ["time", "last"], "values": [["2020-09-02T10:00:00.5Z", "b: init"]]}]}]}`,
+			expected: []Marker{
+				{Indicator: "a", Time: time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC), Note: "write"},
+				{Indicator: "b", Time: time.Date(2020, 9, 2, 10, 0, 0, 5e8, time.UTC), Note: "init"},
+			},
+		},
+		{
+			name:     "untagged",
+			result:   markerResult,
+			expected: []Marker{{Indicator: "ind", Time: time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC), Note: "write"}},
+		},
+		{
+			name:     "note of another indicator",
+			result:   `{"results": [{"statement_id": 0, "series": [{"name": "s", "tags": {"ruminant": "a"}, "columns": ["time", "last"], "values": [["2020-09-01T10:00:00Z", "b: write"]]}]}]}`,
+			expected: []Marker{{Indicator: "a", Time: time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC), Note: "b: write"}},
+		},
+		{
+			name:   "short row",
+			result: `{"results": [{"statement_id": 0, "series": [{"name": "s", "columns": ["time"], "values": [["2020-09-01T10:00:00Z"]]}]}]}`,
+		},
+		{
+			name: "empty",
+		},
+		{
+			name:   "invalid time",
+			result: `{"results": [{"statement_id": 0, "series": [{"name": "s", "columns": ["time", "last"], "values": [[1598954400, "ind: write"]]}]}]}`,
+			err:    `marker time could not be read: parsing time "" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "" as "2006"`,
+		},
+	}
+	for _, test := range tests {
+		f := newFakeInflux(test.result)
+		i := f.influx(t, "")
+		markers, err := i.ListMarkers()
+		f.Close()
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if len(markers) != len(test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, markers)
+			continue
+		}
+		for n, m := range markers {
+			e := test.expected[n]
+			if m.Indicator != e.Indicator || !m.Time.Equal(e.Time) || m.Note != e.Note {
+				t.Errorf("%s: expected %+v, got %+v", test.name, e, m)
+			}
+		}
+	}
+}
+
+func TestSetMarker(t *testing.T) {
+	f := newFakeInflux("")
+	defer f.Close()
+	i := f.influx(t, "www_90d")
+	at := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	if err := i.SetMarker(at, "set"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.queries) != 1 || f.queries[0] != i.DeleteMarkersQuery(at) {
+		t.Errorf("expected newer markers to be deleted first, got %q", f.queries)
+	}
+	write := strings.SplitN(i.MarkerWrite(at, "set"), "\n", 2)[1]
+	if len(f.writes) != 1 || strings.TrimSpace(f.writes[0]) != write {
+		t.Errorf("expected %s to be written, got %q", write, f.writes)
+	}
+	if len(f.params) == 1 && (f.params[0].Get("rp") != "www_90d" || f.params[0].Get("precision") != "s") {
+		t.Errorf("unexpected write parameters %v", f.params[0])
+	}
+}
+
+func TestPrintMarkers(t *testing.T) {
+	var b bytes.Buffer
+	printMarkers(&b, []Marker{
+		{Indicator: "www", Time: time.Date(2020, 9, 1, 10, 0, 0, 0, time.FixedZone("CEST", 7200)), Note: "write"},
+		{Indicator: "www_hourly", Time: time.Date(2020, 9, 2, 0, 0, 0, 0, time.UTC), Note: "init"},
+	})
+	expected := "INDICATOR   TIME                  NOTE\n" +
+		"www         2020-09-01T08:00:00Z  write\n" +
+		"www_hourly  2020-09-02T00:00:00Z  init\n"
+	if b.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
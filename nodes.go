@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	deadBackoffMin = 5 * time.Second
+	deadBackoffMax = 5 * time.Minute
+
+	// DefaultEsTimeout is the time a node may take to respond, unless
+	// configured otherwise.
+	DefaultEsTimeout = 2 * time.Minute
+)
+
+type node struct {
+	url       string
+	failures  int
+	deadUntil time.Time
+}
+
+// NodePool spreads requests across a number of nodes in a round-robin
+// manner. Nodes that fail are marked dead and are not used again until their
+// backoff has expired. The backoff doubles with every consecutive failure.
+type NodePool struct {
+	mu     sync.Mutex
+	nodes  []*node
+	next   int
+	client *http.Client
+}
+
+// NewNodePool creates a pool of the node URLs passed. Requests taking longer
+// than 'timeout', including reading the response, fail like requests to nodes
+// that can't be reached. A zero timeout disables this.
+func NewNodePool(urls []string, timeout time.Duration) *NodePool {
+	p := &NodePool{
+		client: &http.Client{Timeout: timeout},
+	}
+	for _, u := range urls {
+		p.nodes = append(p.nodes, &node{url: strings.TrimRight(u, "/")})
+	}
+	return p
+}
+
+// Replace swaps the nodes of the pool with the addresses ('host:port') passed.
+// The scheme, the credentials and the path prefix of the first node
+// currently known are used for the new nodes.
+func (p *NodePool) Replace(addrs []string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	base := &url.URL{Scheme: "http"}
+	if len(p.nodes) > 0 {
+		if u, err := url.Parse(p.nodes[0].url); err == nil && u.Scheme != "" {
+			base = u
+		}
+	}
+
+	var urls []string
+	p.nodes = []*node{}
+	for _, addr := range addrs {
+		u := url.URL{Scheme: base.Scheme, User: base.User, Host: addr, Path: base.Path}
+		p.nodes = append(p.nodes, &node{url: strings.TrimRight(u.String(), "/")})
+		urls = append(urls, p.nodes[len(p.nodes)-1].url)
+	}
+	p.next = 0
+	return urls
+}
+
+// pick returns the next node that is alive. If all nodes are dead the one
+// with the earliest expiring backoff is returned.
+func (p *NodePool) pick() (*node, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.nodes) < 1 {
+		return nil, fmt.Errorf("no elasticsearch nodes configured")
+	}
+
+	now := time.Now()
+	var candidate *node
+	for i := 0; i < len(p.nodes); i++ {
+		n := p.nodes[(p.next+i)%len(p.nodes)]
+		if !n.deadUntil.After(now) {
+			p.next = (p.next + i + 1) % len(p.nodes)
+			return n, nil
+		}
+		if candidate == nil || n.deadUntil.Before(candidate.deadUntil) {
+			candidate = n
+		}
+	}
+	return candidate, nil
+}
+
+func (p *NodePool) markDead(n *node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	backoff := deadBackoffMin
+	for i := 0; i < n.failures && backoff < deadBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > deadBackoffMax {
+		backoff = deadBackoffMax
+	}
+	n.failures++
+	n.deadUntil = time.Now().Add(backoff)
+}
+
+func (p *NodePool) markAlive(n *node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n.failures = 0
+	n.deadUntil = time.Time{}
+}
+
+// Do sends the request to the next healthy node. If the node cannot be
+// reached or responds as being unavailable, the node is marked dead and the
+// request is retried on the next node. The status code and the body of the
+// response are returned.
+func (p *NodePool) Do(method, path, body string) (int, []byte, error) {
+	p.mu.Lock()
+	attempts := len(p.nodes)
+	p.mu.Unlock()
+
+	var lastErr error
+	for i := 0; i < attempts || i == 0; i++ {
+		n, err := p.pick()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		status, resp, err := p.do(n, method, path, body)
+		if err != nil {
+			p.markDead(n)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				lastErr = fmt.Errorf("node %s timed out after %s: %s", n.url, p.client.Timeout, err.Error())
+			} else {
+				lastErr = fmt.Errorf("node %s failed: %s", n.url, err.Error())
+			}
+			continue
+		}
+		if status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout {
+			p.markDead(n)
+			lastErr = fmt.Errorf("node %s unavailable, status code %d", n.url, status)
+			continue
+		}
+
+		p.markAlive(n)
+		return status, resp, nil
+	}
+	return 0, nil, lastErr
+}
+
+func (p *NodePool) do(n *node, method, path, body string) (int, []byte, error) {
+	req, err := http.NewRequest(method, n.url+path, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, b, nil
+}
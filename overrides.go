@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const envPrefix = "RUMINANT_"
+
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// ConfigKey describes a single key of the configuration that can be
+// overridden, eg. 'gulp.host'.
+type ConfigKey struct {
+	Path string
+	Kind reflect.Kind
+}
+
+// EnvName returns the name of the environment variable that overrides the
+// key, eg. 'RUMINANT_GULP_HOST'.
+func (k ConfigKey) EnvName() string {
+	return envPrefix + strings.ToUpper(strings.Replace(k.Path, ".", "_", -1))
+}
+
+// ConfigKeys returns all keys of the configuration that can be overridden.
+// These are all fields holding scalar values, lists of strings and maps of
+// strings. Lists of structs such as nested iterators are not included.
+func ConfigKeys() []ConfigKey {
+	keys := collectKeys(reflect.TypeOf(Config{}), "")
+	sort.Slice(keys, func(a, b int) bool { return keys[a].Path < keys[b].Path })
+	return keys
+}
+
+func collectKeys(t reflect.Type, prefix string) []ConfigKey {
+	var keys []ConfigKey
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			keys = append(keys, collectKeys(f.Type, path)...)
+		case reflect.Slice:
+			if f.Type.Elem().Kind() == reflect.String {
+				keys = append(keys, ConfigKey{Path: path, Kind: reflect.Slice})
+			}
+		default:
+			keys = append(keys, ConfigKey{Path: path, Kind: f.Type.Kind()})
+		}
+	}
+	return keys
+}
+
+func lookupKey(path string) (ConfigKey, bool) {
+	for _, k := range ConfigKeys() {
+		if k.Path == path {
+			return k, true
+		}
+	}
+	return ConfigKey{}, false
+}
+
+// Override sets the key given to the value passed. Values of string keys
+// are taken as they are, all other values are parsed as YAML.
+func (c *Config) Override(path, value, source string) error {
+	key, ok := lookupKey(path)
+	if !ok {
+		return fmt.Errorf("unknown config key '%s'", path)
+	}
+
+	var v interface{} = value
+	if key.Kind != reflect.String {
+		if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+			return fmt.Errorf("could not parse value of '%s': %s", path, err.Error())
+		}
+	}
+
+	parts := strings.Split(path, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		v = map[string]interface{}{parts[i]: v}
+	}
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return fmt.Errorf("could not set '%s': %s", path, err.Error())
+	}
+
+	c.setSource(path, source)
+	return nil
+}
+
+// OverrideFromEnv applies all 'RUMINANT_*' environment variables matching
+// a config key.
+func (c *Config) OverrideFromEnv() error {
+	for _, k := range ConfigKeys() {
+		value, ok := os.LookupEnv(k.EnvName())
+		if !ok {
+			continue
+		}
+		if err := c.Override(k.Path, value, fmt.Sprintf("%s %s", SourceEnv, k.EnvName())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OverrideFromFlags applies overrides passed as 'key=value'.
+func (c *Config) OverrideFromFlags(sets []string) error {
+	for _, set := range sets {
+		parts := strings.SplitN(set, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("override '%s' must be in the form 'key=value'", set)
+		}
+		if err := c.Override(parts[0], parts[1], fmt.Sprintf("%s --set", SourceFlag)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setSourcesFromFile marks all keys present in the YAML file as set by file.
+func (c *Config) setSourcesFromFile(file []byte) error {
+	var raw interface{}
+	if err := yaml.Unmarshal(file, &raw); err != nil {
+		return err
+	}
+	for _, k := range ConfigKeys() {
+		v := raw
+		found := true
+		for _, part := range strings.Split(k.Path, ".") {
+			m, ok := v.(map[interface{}]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			if v, ok = m[part]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			c.setSource(k.Path, SourceFile)
+		}
+	}
+	return nil
+}
+
+func (c *Config) setSource(path, source string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[path] = source
+}
+
+// Source returns where the effective value of a key comes from.
+func (c Config) Source(path string) string {
+	if s, ok := c.sources[path]; ok {
+		return s
+	}
+	return SourceDefault
+}
+
+// Sources lists all keys with their effective value and the source of the
+// value.
+func (c Config) Sources() string {
+	var raw interface{}
+	b, _ := yaml.Marshal(c)
+	yaml.Unmarshal(b, &raw)
+
+	var out strings.Builder
+	for _, k := range ConfigKeys() {
+		v := raw
+		for _, part := range strings.Split(k.Path, ".") {
+			m, _ := v.(map[interface{}]interface{})
+			v = m[part]
+		}
+		var value string
+		switch v := v.(type) {
+		case string:
+			value = fmt.Sprintf("%q", v)
+		case []interface{}:
+			var elems []string
+			for _, e := range v {
+				elems = append(elems, fmt.Sprintf("%q", e))
+			}
+			value = "[" + strings.Join(elems, ", ") + "]"
+		default:
+			b, _ := yaml.Marshal(v)
+			value = strings.Replace(strings.TrimSpace(string(b)), "\n", ", ", -1)
+		}
+		fmt.Fprintf(&out, "%s: %s # %s\n", k.Path, value, c.Source(k.Path))
+	}
+	return out.String()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigKeys(t *testing.T) {
+	keys := make(map[string]reflect.Kind)
+	for _, k := range ConfigKeys() {
+		keys[k.Path] = k.Kind
+	}
+	expected := map[string]reflect.Kind{
+		"gulp.host":                  reflect.String,
+		"gulp.port":                  reflect.Int,
+		"regurgitate.nodes":          reflect.Slice,
+		"regurgitate.vars":           reflect.Map,
+		"regurgitate.sampler.offset": reflect.Int64,
+	}
+	for path, kind := range expected {
+		if keys[path] != kind {
+			t.Errorf("%s: expected kind %s, got %s", path, kind, keys[path])
+		}
+	}
+	// lists of structs can not be overridden
+	if _, ok := keys["gulp.continuous_queries"]; ok {
+		t.Errorf("gulp.continuous_queries should not be a key")
+	}
+	if name := (ConfigKey{Path: "gulp.retention_policy.name"}).EnvName(); name != "RUMINANT_GULP_RETENTION_POLICY_NAME" {
+		t.Errorf("unexpected env name %s", name)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	tests := []struct {
+		path, value string
+		check       func(c Config) bool
+		err         string
+	}{
+		{"gulp.host", "influx", func(c Config) bool { return c.Gulp.Host == "influx" }, ""},
+		// strings are never parsed as YAML
+		{"gulp.pass", "yes: [no]", func(c Config) bool { return c.Gulp.Pass == "yes: [no]" }, ""},
+		{"gulp.db", "1.10", func(c Config) bool { return c.Gulp.Db == "1.10" }, ""},
+		{"gulp.port", "8087", func(c Config) bool { return c.Gulp.Port == 8087 }, ""},
+		{"regurgitate.sniff", "true", func(c Config) bool { return c.Regurgitate.Sniff }, ""},
+		{"regurgitate.sampler.offset", "2h", func(c Config) bool { return c.Regurgitate.Sampler.Offset == 2*time.Hour }, ""},
+		{"regurgitate.nodes", "[a, b]", func(c Config) bool { return reflect.DeepEqual(c.Regurgitate.Nodes, []string{"a", "b"}) }, ""},
+		{"regurgitate.vars", "{env: prod}", func(c Config) bool { return c.Regurgitate.Vars["env"] == "prod" }, ""},
+		{"gulp.hots", "influx", nil, "unknown config key 'gulp.hots'"},
+		{"gulp.port", "many", nil, "could not set 'gulp.port'"},
+		{"gulp.port", "[1", nil, "could not parse value of 'gulp.port'"},
+	}
+	for _, test := range tests {
+		var c Config
+		err := c.Override(test.path, test.value, SourceFlag)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s=%s: expected error '%s', got %v", test.path, test.value, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s=%s: %s", test.path, test.value, err.Error())
+			continue
+		}
+		if !test.check(c) {
+			t.Errorf("%s=%s: not applied, got %+v", test.path, test.value, c)
+		}
+		if c.Source(test.path) != SourceFlag {
+			t.Errorf("%s: expected source %s, got %s", test.path, SourceFlag, c.Source(test.path))
+		}
+	}
+}
+
+func TestOverrideKeepsOtherKeys(t *testing.T) {
+	var c Config
+	c.Gulp.Host = "influx"
+	c.Gulp.Port = 8086
+	if err := c.Override("gulp.db", "metrics", SourceFlag); err != nil {
+		t.Fatal(err)
+	}
+	if c.Gulp.Host != "influx" || c.Gulp.Port != 8086 || c.Gulp.Db != "metrics" {
+		t.Errorf("unexpected gulp config %+v", c.Gulp)
+	}
+}
+
+func TestOverrideFromEnv(t *testing.T) {
+	os.Setenv("RUMINANT_GULP_PORT", "8087")
+	os.Setenv("RUMINANT_REGURGITATE_SAMPLER_SAMPLES", "3")
+	defer os.Unsetenv("RUMINANT_GULP_PORT")
+	defer os.Unsetenv("RUMINANT_REGURGITATE_SAMPLER_SAMPLES")
+
+	var c Config
+	if err := c.OverrideFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Gulp.Port != 8087 || c.Regurgitate.Sampler.Samples != 3 {
+		t.Errorf("unexpected port %d or samples %d", c.Gulp.Port, c.Regurgitate.Sampler.Samples)
+	}
+	if s := c.Source("gulp.port"); s != "env RUMINANT_GULP_PORT" {
+		t.Errorf("unexpected source %s", s)
+	}
+
+	os.Setenv("RUMINANT_GULP_PORT", "many")
+	if err := c.OverrideFromEnv(); err == nil {
+		t.Errorf("expected an error for an invalid port")
+	}
+}
+
+func TestOverrideFromFlags(t *testing.T) {
+	var c Config
+	err := c.OverrideFromFlags([]string{"gulp.db=staging", "regurgitate.query=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// values are split at the first '='
+	if c.Gulp.Db != "staging" || c.Regurgitate.Query != "a=b" {
+		t.Errorf("unexpected db %s or query %s", c.Gulp.Db, c.Regurgitate.Query)
+	}
+	if c.Source("gulp.db") != "flag --set" || c.Source("gulp.host") != SourceDefault {
+		t.Errorf("unexpected sources %s, %s", c.Source("gulp.db"), c.Source("gulp.host"))
+	}
+	if err := c.OverrideFromFlags([]string{"gulp.db"}); err == nil {
+		t.Errorf("expected an error for an override without value")
+	}
+}
+
+func TestLoadConfSources(t *testing.T) {
+	os.Setenv("RUMINANT_GULP_DB", "from_env")
+	defer os.Unsetenv("RUMINANT_GULP_DB")
+	file := writeConf(t, "gulp:\n  host: influx\n  db: from_file\n  port: 8086\n")
+	defer os.Remove(file)
+
+	c, err := loadConf(file, true, []string{"gulp.port=8087"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"gulp.host:": `gulp.host: "influx" # file`,
+		"gulp.db:":   `gulp.db: "from_env" # env RUMINANT_GULP_DB`,
+		"gulp.port:": `gulp.port: 8087 # flag --set`,
+		"gulp.user:": `gulp.user: "" # default`,
+	}
+	for _, line := range strings.Split(c.Sources(), "\n") {
+		for prefix, e := range expected {
+			if strings.HasPrefix(line, prefix) && line != e {
+				t.Errorf("expected %s, got %s", e, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errStop can be returned by the emit function passed to Pool.Run in order
+// to stop the pool without reporting an error.
+var errStop = errors.New("stop")
+
+// Pool runs jobs concurrently with a bounded number of workers. The rate at
+// which jobs are started can be limited to a maximum number of jobs per
+// second.
+type Pool struct {
+	Workers int
+	MaxQps  float64
+}
+
+func NewPool(workers int, maxQps float64) Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return Pool{
+		Workers: workers,
+		MaxQps:  maxQps,
+	}
+}
+
+type poolResult struct {
+	index int
+	res   interface{}
+	err   error
+}
+
+// Run executes 'work' for the indices 0 to n-1. The results are passed to
+// 'emit' strictly in the order of their indices, regardless of the order the
+// jobs complete in. Only a limited number of results are buffered, so jobs
+// are not started too far ahead of the results emitted. The first error
+// returned by either 'work' or 'emit' stops the pool: no further jobs are
+// started, the running jobs are waited for and the error is returned.
+func (p Pool) Run(n int, work func(i int) (interface{}, error), emit func(i int, res interface{}) error) error {
+	jobs := make(chan int)
+	results := make(chan poolResult)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res, err := work(i)
+				select {
+				case results <- poolResult{index: i, res: res, err: err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	var throttle <-chan time.Time
+	if p.MaxQps > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / p.MaxQps))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	window := p.Workers * 2
+	pending := make(map[int]interface{})
+	next, emitted := 0, 0
+	ready := true
+	var err error
+
+	for emitted < n && err == nil {
+		var dispatch chan int
+		var tick <-chan time.Time
+		if next < n && next-emitted < window {
+			if ready {
+				dispatch = jobs
+			} else {
+				tick = throttle
+			}
+		}
+
+		select {
+		case dispatch <- next:
+			next++
+			ready = throttle == nil
+		case <-tick:
+			ready = true
+		case r := <-results:
+			if r.err != nil {
+				err = r.err
+				break
+			}
+			pending[r.index] = r.res
+			for {
+				res, ok := pending[emitted]
+				if !ok {
+					break
+				}
+				delete(pending, emitted)
+				if err = emit(emitted, res); err != nil {
+					break
+				}
+				emitted++
+			}
+		}
+	}
+
+	close(done)
+	close(jobs)
+	wg.Wait()
+
+	if err == errStop {
+		return nil
+	}
+	return err
+}
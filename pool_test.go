@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolRunOrder(t *testing.T) {
+	p := NewPool(4, 0)
+	var emitted []int
+	err := p.Run(20, func(i int) (interface{}, error) {
+		// later jobs complete first
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		return i * 10, nil
+	}, func(i int, res interface{}) error {
+		if res.(int) != i*10 {
+			t.Errorf("result %v passed for job %d", res, i)
+		}
+		emitted = append(emitted, i)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(emitted))
+	}
+	for n, i := range emitted {
+		if n != i {
+			t.Fatalf("results emitted out of order: %v", emitted)
+		}
+	}
+}
+
+func TestPoolRunWorkers(t *testing.T) {
+	var mu sync.Mutex
+	running, max := 0, 0
+	err := NewPool(3, 0).Run(12, func(i int) (interface{}, error) {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil, nil
+	}, func(i int, res interface{}) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max > 3 {
+		t.Errorf("%d jobs ran concurrently with 3 workers", max)
+	}
+}
+
+func TestPoolRunStop(t *testing.T) {
+	var mu sync.Mutex
+	started := 0
+	var emitted []int
+	err := NewPool(2, 0).Run(100, func(i int) (interface{}, error) {
+		mu.Lock()
+		started++
+		mu.Unlock()
+		return nil, nil
+	}, func(i int, res interface{}) error {
+		emitted = append(emitted, i)
+		if i == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("errStop should not be reported, got %s", err.Error())
+	}
+	if len(emitted) != 3 {
+		t.Errorf("expected 3 results before stopping, got %v", emitted)
+	}
+	if started > 10 {
+		t.Errorf("%d jobs started, the pool should not run far ahead", started)
+	}
+}
+
+func TestPoolRunErrors(t *testing.T) {
+	failed := errors.New("failed")
+	err := NewPool(2, 0).Run(10, func(i int) (interface{}, error) {
+		if i == 3 {
+			return nil, failed
+		}
+		return nil, nil
+	}, func(i int, res interface{}) error {
+		if i >= 3 {
+			t.Errorf("result %d emitted after the failed job", i)
+		}
+		return nil
+	})
+	if err != failed {
+		t.Errorf("expected the error of the job, got %v", err)
+	}
+
+	err = NewPool(2, 0).Run(10, func(i int) (interface{}, error) {
+		return nil, nil
+	}, func(i int, res interface{}) error {
+		return failed
+	})
+	if err != failed {
+		t.Errorf("expected the error of emit, got %v", err)
+	}
+}
+
+func TestPoolRunMaxQps(t *testing.T) {
+	start := time.Now()
+	err := NewPool(4, 50).Run(6, func(i int) (interface{}, error) {
+		return nil, nil
+	}, func(i int, res interface{}) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first job starts right away, the others every 20ms
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("6 jobs at 50 qps took only %s", d)
+	}
+}
+
+func TestNewPool(t *testing.T) {
+	if p := NewPool(0, 0); p.Workers != 1 {
+		t.Errorf("expected at least one worker, got %d", p.Workers)
+	}
+	if err := NewPool(2, 0).Run(0, nil, nil); err != nil {
+		t.Errorf("expected no error without jobs, got %s", err.Error())
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
+)
+
+// Formats the data dumped by 'poop' can be written in.
+const (
+	PoopCSV    = "csv"
+	PoopTSV    = "tsv"
+	PoopJSON   = "json"
+	PoopNDJSON = "ndjson"
+)
+
+var PoopFormats = []string{PoopCSV, PoopTSV, PoopJSON, PoopNDJSON}
+
+// poopAllFields is the key of the number format used for fields that are not
+// configured explicitly.
+const poopAllFields = "*"
+
+// RowWriter writes the rows of a query result.
+type RowWriter interface {
+	// Header is called once before the first row with the column names.
+	Header(columns []string) error
+	Row(values []interface{}) error
+	Close() error
+}
+
+// NewRowWriter returns a writer for the format given. Timestamps, numbers and
+// missing values are formatted as configured in 'c'.
+func NewRowWriter(w io.Writer, format string, c PoopConf) (RowWriter, error) {
+	f := rowFormatter{conf: c}
+	for field, spec := range c.NumberFormat {
+		switch spec {
+		case "f", "e", "g":
+		default:
+			return nil, fmt.Errorf("number format '%s' of field '%s' is not supported, use 'f', 'e' or 'g'", spec, field)
+		}
+	}
+
+	switch format {
+	case PoopCSV, PoopTSV:
+		sep := c.Separator
+		if format == PoopTSV {
+			sep = "\t"
+		}
+		if sep == "" || strings.ContainsAny(sep, "\"\r\n") || !utf8.ValidString(sep) {
+			return nil, fmt.Errorf("separator '%s' must not be empty or contain quotes or line breaks", sep)
+		}
+		if r, size := utf8.DecodeRuneInString(sep); size == len(sep) {
+			cw := csv.NewWriter(w)
+			cw.Comma = r
+			return &delimitedWriter{f: f, w: cw}, nil
+		}
+		return &delimitedWriter{f: f, w: &joinWriter{w: bufio.NewWriter(w), sep: sep}}, nil
+	case PoopJSON, PoopNDJSON:
+		return &jsonRowWriter{f: f, w: w, list: format == PoopJSON}, nil
+	}
+	return nil, fmt.Errorf("unsupported format '%s', must be one of %s", format, strings.Join(PoopFormats, ", "))
+}
+
+// rowFormatter converts the values returned by InfluxDB.
+type rowFormatter struct {
+	conf    PoopConf
+	columns []string
+}
+
+// value returns the value of a column either as string, number, boolean or
+// nil. Numbers are returned as json.Number formatted as configured.
+func (f rowFormatter) value(col int, v interface{}) (interface{}, error) {
+	name := f.columns[col]
+	if s, ok := v.(string); ok && name == "time" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("time could not be read: %s", err.Error())
+		}
+		return t.Format(f.conf.Format), nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return v, nil
+	}
+
+	precision, hasPrecision := f.conf.Precision[name]
+	if !hasPrecision {
+		precision, hasPrecision = f.conf.Precision[poopAllFields]
+	}
+	spec, hasSpec := f.conf.NumberFormat[name]
+	if !hasSpec {
+		spec, hasSpec = f.conf.NumberFormat[poopAllFields]
+	}
+	if !hasPrecision && !hasSpec {
+		// the number is passed on as returned by InfluxDB
+		return n, nil
+	}
+	if !hasPrecision {
+		precision = -1
+	}
+	if !hasSpec {
+		spec = "f"
+	}
+	number, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return json.Number(strconv.FormatFloat(number, spec[0], precision, 64)), nil
+}
+
+// delimitedWriter writes CSV or TSV with quoting as of RFC 4180.
+type delimitedWriter struct {
+	f rowFormatter
+	w recordWriter
+}
+
+// recordWriter is implemented by csv.Writer and joinWriter.
+type recordWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// joinWriter writes records separated by a separator of more than one
+// character, which csv.Writer does not support. Fields are quoted the way
+// csv.Writer does.
+type joinWriter struct {
+	w   *bufio.Writer
+	sep string
+	err error
+}
+
+func (j *joinWriter) Write(record []string) error {
+	for n, field := range record {
+		if n > 0 {
+			j.w.WriteString(j.sep)
+		}
+		if j.needsQuotes(field) {
+			field = `"` + strings.Replace(field, `"`, `""`, -1) + `"`
+		}
+		j.w.WriteString(field)
+	}
+	_, err := j.w.WriteString("\n")
+	return err
+}
+
+func (j *joinWriter) needsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.Contains(field, j.sep) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
+}
+
+func (j *joinWriter) Flush() {
+	j.err = j.w.Flush()
+}
+
+func (j *joinWriter) Error() error {
+	return j.err
+}
+
+func (d *delimitedWriter) Header(columns []string) error {
+	d.f.columns = columns
+	return d.w.Write(columns)
+}
+
+func (d *delimitedWriter) Row(values []interface{}) error {
+	record := make([]string, len(values))
+	for n, v := range values {
+		v, err := d.f.value(n, v)
+		if err != nil {
+			return err
+		}
+		switch v := v.(type) {
+		case nil:
+			record[n] = d.f.conf.ReplaceNil
+		case string:
+			record[n] = v
+		case json.Number:
+			record[n] = v.String()
+		default:
+			record[n] = fmt.Sprint(v)
+		}
+	}
+	return d.w.Write(record)
+}
+
+func (d *delimitedWriter) Close() error {
+	d.w.Flush()
+	return d.w.Error()
+}
+
+// jsonRowWriter writes every row as object keyed by the column names, either
+// as a single list or as one object per line.
+type jsonRowWriter struct {
+	f     rowFormatter
+	w     io.Writer
+	list  bool
+	count int
+}
+
+func (j *jsonRowWriter) Header(columns []string) error {
+	j.f.columns = columns
+	return nil
+}
+
+func (j *jsonRowWriter) Row(values []interface{}) error {
+	// the object is built by hand to keep the order of the columns
+	var b bytes.Buffer
+	b.WriteString("{")
+	for n, v := range values {
+		v, err := j.f.value(n, v)
+		if err != nil {
+			return err
+		}
+		key, _ := json.Marshal(j.f.columns[n])
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			b.WriteString(",")
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(value)
+	}
+	b.WriteString("}")
+
+	prefix := "\n"
+	if j.list {
+		prefix = ",\n  "
+		if j.count == 0 {
+			prefix = "[\n  "
+		}
+	} else if j.count == 0 {
+		prefix = ""
+	}
+	j.count++
+	_, err := fmt.Fprintf(j.w, "%s%s", prefix, b.String())
+	return err
+}
+
+func (j *jsonRowWriter) Close() error {
+	var err error
+	switch {
+	case j.list && j.count == 0:
+		_, err = fmt.Fprintln(j.w, "[]")
+	case j.list:
+		_, err = fmt.Fprintln(j.w, "\n]")
+	case j.count > 0:
+		_, err = fmt.Fprintln(j.w)
+	}
+	return err
+}
+
+// WriteResults writes all series of the results returned by InfluxDB. The
+// tags of grouped series are written as columns following the time, the tags
+// listed in 'tags' first, all others sorted by name. Columns missing in a
+// series are written as missing values. If the results hold no series at
+// all, only a header consisting of 'fields' is written.
+func WriteResults(w RowWriter, results []client.Result, tags, fields []string) error {
+	var series []models.Row
+	for _, r := range results {
+		if r.Err != "" {
+			return fmt.Errorf("%s", r.Err)
+		}
+		series = append(series, r.Series...)
+	}
+	if len(series) < 1 {
+		if err := w.Header(fields); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+
+	// the columns of all series are collected first, each series may have
+	// other tags or columns
+	tagSet := make(map[string]string)
+	for _, s := range series {
+		for key := range s.Tags {
+			tagSet[key] = ""
+		}
+	}
+	var tagColumns []string
+	for _, key := range tags {
+		if _, ok := tagSet[key]; ok {
+			tagColumns = append(tagColumns, key)
+			delete(tagSet, key)
+		}
+	}
+	tagColumns = append(tagColumns, sortedKeys(tagSet)...)
+
+	columns := []string{"time"}
+	index := map[string]int{"time": 0}
+	add := func(name string) {
+		if _, ok := index[name]; !ok {
+			index[name] = len(columns)
+			columns = append(columns, name)
+		}
+	}
+	for _, key := range tagColumns {
+		add(key)
+	}
+	for _, s := range series {
+		for _, col := range s.Columns {
+			add(col)
+		}
+	}
+
+	if err := w.Header(columns); err != nil {
+		return err
+	}
+	for _, s := range series {
+		for _, values := range s.Values {
+			row := make([]interface{}, len(columns))
+			for key, value := range s.Tags {
+				row[index[key]] = value
+			}
+			for n, value := range values {
+				// a tag selected as field is empty in grouped series
+				if n < len(s.Columns) && value != nil {
+					row[index[s.Columns[n]]] = value
+				}
+			}
+			if err := w.Row(row); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Close()
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
+)
+
+func writeRows(t *testing.T, format string, c PoopConf, columns []string, rows ...[]interface{}) (string, error) {
+	var out bytes.Buffer
+	w, err := NewRowWriter(&out, format, c)
+	if err != nil {
+		return "", err
+	}
+	if err := w.Header(columns); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.Row(row); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), nil
+}
+
+func TestRowWriter(t *testing.T) {
+	columns := []string{"time", "host", "bytes", "note"}
+	rows := [][]interface{}{
+		{"2020-03-01T12:00:00Z", "a", json.Number("1.25"), `say "hi", bye`},
+		{"2020-03-01T13:00:00Z", "b;c", json.Number("12345678901"), nil},
+	}
+	conf := func(sep string, precision map[string]int, formats map[string]string) PoopConf {
+		c := DefaultConf().Poop
+		c.Format = "2006-01-02 15:04"
+		c.Separator = sep
+		c.Precision = precision
+		c.NumberFormat = formats
+		return c
+	}
+	tests := []struct {
+		name   string
+		format string
+		conf   PoopConf
+		out    string
+	}{
+		{"csv", PoopCSV, conf(",", nil, nil), `time,host,bytes,note
+2020-03-01 12:00,a,1.25,"say ""hi"", bye"
+2020-03-01 13:00,b;c,12345678901,[NIL]
+`},
+		{"semicolon", PoopCSV, conf(";", nil, nil), `time;host;bytes;note
+2020-03-01 12:00;a;1.25;"say ""hi"", bye"
+2020-03-01 13:00;"b;c";12345678901;[NIL]
+`},
+		{"multi-char separator", PoopCSV, conf(" | ", nil, nil), `time | host | bytes | note
+2020-03-01 12:00 | a | 1.25 | "say ""hi"", bye"
+2020-03-01 13:00 | b;c | 12345678901 | [NIL]
+`},
+		{"multi-char separator in value", PoopCSV, conf(";c", nil, nil), `time;chost;cbytes;cnote
+2020-03-01 12:00;ca;c1.25;c"say ""hi"", bye"
+2020-03-01 13:00;c"b;c";c12345678901;c[NIL]
+`},
+		{"tsv", PoopTSV, conf(",", nil, nil), "time\thost\tbytes\tnote\n" +
+			"2020-03-01 12:00\ta\t1.25\t\"say \"\"hi\"\", bye\"\n" +
+			"2020-03-01 13:00\tb;c\t12345678901\t[NIL]\n"},
+		{"precision", PoopCSV, conf(",", map[string]int{"*": 1}, nil), `time,host,bytes,note
+2020-03-01 12:00,a,1.2,"say ""hi"", bye"
+2020-03-01 13:00,b;c,12345678901.0,[NIL]
+`},
+		{"number format", PoopCSV, conf(",", map[string]int{"bytes": 2}, map[string]string{"bytes": "e"}), `time,host,bytes,note
+2020-03-01 12:00,a,1.25e+00,"say ""hi"", bye"
+2020-03-01 13:00,b;c,1.23e+10,[NIL]
+`},
+		{"json", PoopJSON, conf(",", nil, nil), `[
+  {"time":"2020-03-01 12:00","host":"a","bytes":1.25,"note":"say \"hi\", bye"},
+  {"time":"2020-03-01 13:00","host":"b;c","bytes":12345678901,"note":null}
+]
+`},
+		{"ndjson", PoopNDJSON, conf(",", nil, nil), `{"time":"2020-03-01 12:00","host":"a","bytes":1.25,"note":"say \"hi\", bye"}
+{"time":"2020-03-01 13:00","host":"b;c","bytes":12345678901,"note":null}
+`},
+	}
+	for _, test := range tests {
+		out, err := writeRows(t, test.format, test.conf, columns, rows...)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+		if out != test.out {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name, test.out, out)
+		}
+	}
+
+	// empty results
+	for format, expected := range map[string]string{PoopJSON: "[]\n", PoopNDJSON: "", PoopCSV: "time\n"} {
+		out, err := writeRows(t, format, conf(",", nil, nil), []string{"time"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != expected {
+			t.Errorf("%s: expected %q for no rows, got %q", format, expected, out)
+		}
+	}
+}
+
+func TestRowWriterErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		sep    string
+		spec   string
+		err    string
+	}{
+		{PoopCSV, "", "", "separator '' must not be empty"},
+		{PoopCSV, `"`, "", "must not be empty or contain quotes or line breaks"},
+		{PoopCSV, "\r\n", "", "must not be empty or contain quotes or line breaks"},
+		{PoopCSV, ",", "x", "number format 'x' of field 'bytes' is not supported"},
+		{"xml", ",", "", "unsupported format 'xml'"},
+	}
+	for _, test := range tests {
+		c := DefaultConf().Poop
+		c.Separator = test.sep
+		if test.spec != "" {
+			c.NumberFormat = map[string]string{"bytes": test.spec}
+		}
+		_, err := NewRowWriter(&bytes.Buffer{}, test.format, c)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s %q: expected error '%s', got %v", test.format, test.sep, test.err, err)
+		}
+	}
+
+	_, err := writeRows(t, PoopCSV, DefaultConf().Poop, []string{"time"}, []interface{}{"yesterday"})
+	if err == nil || !strings.Contains(err.Error(), "time could not be read") {
+		t.Errorf("expected an error for an invalid time, got %v", err)
+	}
+}
+
+// recordingRowWriter records the header and rows written.
+type recordingRowWriter struct {
+	header []string
+	rows   [][]interface{}
+	closed bool
+}
+
+func (r *recordingRowWriter) Header(columns []string) error {
+	r.header = columns
+	return nil
+}
+
+func (r *recordingRowWriter) Row(values []interface{}) error {
+	r.rows = append(r.rows, values)
+	return nil
+}
+
+func (r *recordingRowWriter) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestWriteResults(t *testing.T) {
+	results := []client.Result{
+		{Series: []models.Row{
+			{
+				Name:    "www",
+				Tags:    map[string]string{"host": "a", "dc": "x"},
+				Columns: []string{"time", "count"},
+				Values:  [][]interface{}{{"t1", json.Number("1")}, {"t2", json.Number("2")}},
+			},
+			{
+				Name:    "www",
+				Tags:    map[string]string{"host": "b", "dc": "x"},
+				Columns: []string{"time", "count"},
+				Values:  [][]interface{}{{"t1", json.Number("3")}},
+			},
+		}},
+		// a later chunk with a series holding another column
+		{Series: []models.Row{
+			{
+				Name:    "www",
+				Tags:    map[string]string{"host": "a", "dc": "y"},
+				Columns: []string{"time", "count", "bytes"},
+				Values:  [][]interface{}{{"t3", json.Number("4"), json.Number("10")}},
+			},
+		}},
+	}
+	w := &recordingRowWriter{}
+	if err := WriteResults(w, results, []string{"host"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	header := []string{"time", "host", "dc", "count", "bytes"}
+	if !reflect.DeepEqual(w.header, header) {
+		t.Errorf("expected header %v, got %v", header, w.header)
+	}
+	rows := [][]interface{}{
+		{"t1", "a", "x", json.Number("1"), nil},
+		{"t2", "a", "x", json.Number("2"), nil},
+		{"t1", "b", "x", json.Number("3"), nil},
+		{"t3", "a", "y", json.Number("4"), json.Number("10")},
+	}
+	if !reflect.DeepEqual(w.rows, rows) {
+		t.Errorf("expected rows %v, got %v", rows, w.rows)
+	}
+	if !w.closed {
+		t.Errorf("writer not closed")
+	}
+}
+
+func TestWriteResultsTagAsField(t *testing.T) {
+	// a tag that is grouped by and selected is returned as empty field
+	results := []client.Result{{Series: []models.Row{{
+		Tags:    map[string]string{"host": "a"},
+		Columns: []string{"time", "host", "count"},
+		Values:  [][]interface{}{{"t1", nil, json.Number("1")}},
+	}}}}
+	w := &recordingRowWriter{}
+	if err := WriteResults(w, results, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w.header, []string{"time", "host", "count"}) {
+		t.Errorf("unexpected header %v", w.header)
+	}
+	if !reflect.DeepEqual(w.rows, [][]interface{}{{"t1", "a", json.Number("1")}}) {
+		t.Errorf("unexpected rows %v", w.rows)
+	}
+}
+
+func TestWriteResultsEmpty(t *testing.T) {
+	w := &recordingRowWriter{}
+	if err := WriteResults(w, []client.Result{{}}, nil, []string{"time", "count"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w.header, []string{"time", "count"}) || len(w.rows) > 0 || !w.closed {
+		t.Errorf("expected only the header of the fields, got %v %v", w.header, w.rows)
+	}
+
+	err := WriteResults(&recordingRowWriter{}, []client.Result{{Err: "database not found: www"}}, nil, nil)
+	if err == nil || err.Error() != "database not found: www" {
+		t.Errorf("expected the error of the result, got %v", err)
+	}
+}
+
+func TestDefaultPoopQuery(t *testing.T) {
+	tmpl, err := template.New("query").Parse(DefaultConf().Poop.Query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var query bytes.Buffer
+	err = tmpl.Execute(&query, map[string]interface{}{
+		"Fields": []string{"time", "count"}, "Series": "hits", "RetentionPolicy": "",
+		"Start": "'2020-03-01T00:00:00Z'", "End": "'2020-03-02T00:00:00Z'", "GroupBy": []string{"host"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// consecutive exports must neither lose nor repeat the points at their borders
+	expected := `SELECT "time","count" FROM "hits" WHERE time >= '2020-03-01T00:00:00Z' AND time < '2020-03-02T00:00:00Z' GROUP BY "host"`
+	if query.String() != expected {
+		t.Errorf("expected %s, got %s", expected, query.String())
+	}
+}
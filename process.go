@@ -14,56 +14,83 @@ func Burp(j []byte, i Iterator, inherited Point) ([]Point, string, error) {
 	if i.Selector == "" {
 		return points, string(j), fmt.Errorf("no selector definded")
 	}
-	points, _, jsonFragment, err := process(j, i, inherited, true)
+	doc, err := prepare(j, &i)
+	if err != nil {
+		return points, "", err
+	}
+	points, _, jsonFragment, err := process(doc, i, inherited, true, nil)
 	return points, jsonFragment, err
 }
 
 func Chew(j []byte, i Iterator, inherited Point) ([]Point, error) {
+	return ChewCounted(j, i, inherited, nil)
+}
+
+// ChewCounted works like Chew and adds the number of points produced by each
+// iterator to 'counts', keyed by the path of the iterator in the config.
+func ChewCounted(j []byte, i Iterator, inherited Point, counts map[string]int) ([]Point, error) {
 	var points []Point
 	if i.Selector == "" {
 		return points, fmt.Errorf("no selector definded")
 	}
-	points, _, _, err := process(j, i, inherited, false)
+	doc, err := prepare(j, &i)
+	if err != nil {
+		return points, err
+	}
+	points, _, _, err = process(doc, i, inherited, false, counts)
 	return points, err
 }
 
-func process(j []byte, i Iterator, inherited Point, test bool) ([]Point, bool, string, error) {
-	var results []Point
-
-	selected, err := queryBytes(j, i.Selector)
-	if err != nil {
-		return results, false, "", err
+// prepare compiles the iterator unless this is already done and decodes the
+// JSON document to be processed.
+func prepare(j []byte, i *Iterator) (interface{}, error) {
+	if i.compiled == nil {
+		if err := i.Compile(); err != nil {
+			return nil, err
+		}
 	}
+	var doc interface{}
+	err := json.Unmarshal(j, &doc)
+	return doc, err
+}
 
-	var elements []interface{}
+func process(doc interface{}, i Iterator, inherited Point, test bool, counts map[string]int) ([]Point, bool, string, error) {
+	var results []Point
+	c := i.compiled
 
-	err = json.Unmarshal(selected, &elements)
+	selected, err := c.selector.Eval(doc)
 	if err != nil {
 		return results, false, "", err
 	}
+	elements, ok := selected.([]interface{})
+	if !ok && selected != nil {
+		return results, false, "", fmt.Errorf("selector '%s' does not select an array", i.Selector)
+	}
 
-	for _, element := range elements {
+	for _, elem := range elements {
 		point := inherited.Copy()
-		elem, err := json.MarshalIndent(element, "", "  ")
-
-		if err != nil {
-			return results, false, "", err
-		}
 
-		if i.Time != "" {
-			out, err := query(elem, i.Time)
+		if c.time != nil {
+			out, err := c.time.Eval(elem)
 			if err != nil {
 				return results, false, "", err
 			}
-			if f, ok := out.(float64); ok {
-				point.Timestamp = time.Unix(int64(f)/1000, 0)
-			} else {
+			switch t := out.(type) {
+			case float64:
+				// epoch milliseconds as returned by ElasticSearch
+				point.Timestamp = time.Unix(0, int64(t)*int64(time.Millisecond))
+			case string:
+				point.Timestamp, err = time.Parse(time.RFC3339Nano, t)
+				if err != nil {
+					return results, false, "", fmt.Errorf("time could not be read: %s", err.Error())
+				}
+			default:
 				return results, false, " ", fmt.Errorf("time could not be read")
 			}
 		}
 
-		for key, selector := range i.Values {
-			out, err := query(elem, selector)
+		for key, e := range c.values {
+			out, err := e.Eval(elem)
 			if err != nil {
 				return results, false, "", err
 			}
@@ -74,13 +101,12 @@ func process(j []byte, i Iterator, inherited Point, test bool) ([]Point, bool, s
 			point.Values[key] = value
 		}
 
-		for key, selector := range i.Tags {
-			out, err := queryBytes(elem, selector)
+		for key, e := range c.tags {
+			out, err := e.Eval(elem)
 			if err != nil {
 				return results, false, "", err
 			}
-			trimmed := strings.Trim(string(out), "\"\\")
-			point.Tags[key] = trimmed
+			point.Tags[key] = tagValue(out)
 		}
 
 		for key, value := range i.FixedTags {
@@ -89,7 +115,7 @@ func process(j []byte, i Iterator, inherited Point, test bool) ([]Point, bool, s
 
 		if len(i.Iterators) > 0 {
 			for _, iterator := range i.Iterators {
-				processed, stop, jsonFragment, err := process(elem, iterator, point, test)
+				processed, stop, jsonFragment, err := process(elem, iterator, point, test, counts)
 				if err != nil {
 					return results, false, "", err
 				}
@@ -100,8 +126,15 @@ func process(j []byte, i Iterator, inherited Point, test bool) ([]Point, bool, s
 			}
 		} else {
 			results = append(results, point)
+			if counts != nil {
+				counts[c.path]++
+			}
 			if test {
-				return results, true, string(elem), nil
+				fragment, err := json.MarshalIndent(elem, "", "  ")
+				if err != nil {
+					return results, false, "", err
+				}
+				return results, true, string(fragment), nil
 			}
 		}
 	}
@@ -109,34 +142,93 @@ func process(j []byte, i Iterator, inherited Point, test bool) ([]Point, bool, s
 	return results, false, "", nil
 }
 
-func queryBytes(j []byte, q string) ([]byte, error) {
-	result, err := query(j, q)
-	if err != nil {
-		return []byte{}, err
+// tagValue converts the result of an expression to a tag. Strings are used as
+// they are, all other values are written as JSON.
+func tagValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
 	}
-	return json.Marshal(result)
+	b, _ := json.Marshal(v)
+	return strings.Trim(string(b), "\"\\")
 }
 
-func query(j []byte, q string) (interface{}, error) {
-	var umsg jee.BMsg
-	l, err := jee.Lexer(q)
-	if err != nil {
-		return nil, err
+// compiledIterator holds the compiled expressions of an iterator.
+type compiledIterator struct {
+	// path is the location of the iterator in the config, eg.
+	// 'ruminate.iterator.iterators[0]'.
+	path     string
+	selector Expression
+	time     Expression
+	tags     map[string]Expression
+	values   map[string]Expression
+}
+
+// Compile compiles the expressions of the iterator and all nested iterators
+// so they are parsed only once no matter how many elements are processed.
+// Iterators without 'lang' use the language of their parent, 'jee' is used
+// if no language is configured at all.
+func (i *Iterator) Compile() error {
+	return i.compile(LangJee, "ruminate.iterator")
+}
+
+func (i *Iterator) compile(inherited, path string) error {
+	lang := i.Lang
+	if lang == "" {
+		lang = inherited
+	}
+	c := &compiledIterator{
+		path:   path,
+		tags:   make(map[string]Expression),
+		values: make(map[string]Expression),
+	}
+	var err error
+	if c.selector, err = CompileExpression(lang, i.Selector); err != nil {
+		return fmt.Errorf("invalid selector '%s': %s", i.Selector, err.Error())
+	}
+	if i.Time != "" {
+		if c.time, err = CompileExpression(lang, i.Time); err != nil {
+			return fmt.Errorf("invalid time selector '%s': %s", i.Time, err.Error())
+		}
+	}
+	for key, selector := range i.Tags {
+		if c.tags[key], err = CompileExpression(lang, selector); err != nil {
+			return fmt.Errorf("invalid selector '%s' of tag '%s': %s", selector, key, err.Error())
+		}
+	}
+	for key, selector := range i.Values {
+		if c.values[key], err = CompileExpression(lang, selector); err != nil {
+			return fmt.Errorf("invalid selector '%s' of value '%s': %s", selector, key, err.Error())
+		}
 	}
 
-	tree, err := jee.Parser(l)
-	if err != nil {
-		return nil, err
+	// the nested iterators are copied since the list may be shared with
+	// other copies of the iterator
+	iterators := make([]Iterator, len(i.Iterators))
+	copy(iterators, i.Iterators)
+	for n := range iterators {
+		if err := iterators[n].compile(lang, fmt.Sprintf("%s.iterators[%d]", path, n)); err != nil {
+			return err
+		}
+	}
+	if len(iterators) > 0 {
+		i.Iterators = iterators
 	}
+	i.compiled = c
+	return nil
+}
 
-	err = json.Unmarshal(j, &umsg)
+// query evaluates a jee expression on a JSON document.
+func query(j []byte, q string) (interface{}, error) {
+	var umsg jee.BMsg
+	e, err := CompileExpression(LangJee, q)
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := jee.Eval(tree, umsg)
+	err = json.Unmarshal(j, &umsg)
 	if err != nil {
 		return nil, err
 	}
-	return result, nil
+
+	return e.Eval(umsg)
 }
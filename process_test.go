@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChewTimestamps(t *testing.T) {
+	response := []byte(`{"hits": {"hits": [
+		{"_source": {"@timestamp": "2020-09-01T10:00:00.123Z", "n": 1}},
+		{"_source": {"@timestamp": "2020-09-01T10:00:00.456Z", "n": 2}},
+		{"_source": {"@timestamp": 1598954400789, "n": 3}}
+	]}}`)
+	iterator := Iterator{
+		Selector: ".hits.hits[]",
+		Time:     "._source.@timestamp",
+		Values:   map[string]string{"n": "._source.n"},
+	}
+	points, err := Chew(response, iterator, Point{Tags: map[string]string{}, Values: map[string]interface{}{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Time{
+		time.Date(2020, 9, 1, 10, 0, 0, 123000000, time.UTC),
+		time.Date(2020, 9, 1, 10, 0, 0, 456000000, time.UTC),
+		time.Date(2020, 9, 1, 10, 0, 0, 789000000, time.UTC),
+	}
+	if len(points) != len(expected) {
+		t.Fatalf("expected %d points, got %d", len(expected), len(points))
+	}
+	for n, p := range points {
+		if !p.Timestamp.Equal(expected[n]) {
+			t.Errorf("point %d: expected %s, got %s", n, expected[n], p.Timestamp)
+		}
+	}
+}
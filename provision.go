@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// quoteIdent quotes an identifier in InfluxQL.
+func quoteIdent(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
+
+// CreateDatabase creates the database unless it exists already.
+func (i Influx) CreateDatabase() error {
+	_, err := i.Query("CREATE DATABASE " + quoteIdent(i.DB))
+	return err
+}
+
+// EnsureRetentionPolicy creates the retention policy or updates it if it
+// exists with other settings. The statement run is returned, it is empty if
+// the policy is up to date.
+func (i Influx) EnsureRetentionPolicy(rp RetentionPolicyConf) (string, error) {
+	res, err := i.Query("SHOW RETENTION POLICIES ON " + quoteIdent(i.DB))
+	if err != nil {
+		return "", err
+	}
+	exists := false
+	for _, r := range res {
+		for _, s := range r.Series {
+			for _, row := range s.Values {
+				if len(row) > 0 && row[0] == rp.Name {
+					exists = true
+					if retentionPolicyMatches(rp, s.Columns, row) {
+						return "", nil
+					}
+				}
+			}
+		}
+	}
+
+	stmt := "CREATE"
+	if exists {
+		stmt = "ALTER"
+	}
+	stmt += fmt.Sprintf(" RETENTION POLICY %s ON %s DURATION %s REPLICATION %d", quoteIdent(rp.Name), quoteIdent(i.DB), rp.Duration, rp.Replication)
+	if rp.ShardDuration != "" {
+		stmt += " SHARD DURATION " + rp.ShardDuration
+	}
+	if rp.Default {
+		stmt += " DEFAULT"
+	}
+	_, err = i.Query(stmt)
+	return stmt, err
+}
+
+// retentionPolicyMatches tells whether a row of SHOW RETENTION POLICIES has
+// the configured settings. The shard duration is only compared if it is
+// configured since InfluxDB picks one otherwise, and a policy that is the
+// default already stays so.
+func retentionPolicyMatches(rp RetentionPolicyConf, columns []string, row []interface{}) bool {
+	field := map[string]interface{}{}
+	for n, c := range columns {
+		if n < len(row) {
+			field[c] = row[n]
+		}
+	}
+	if !durationMatches(rp.Duration, field["duration"]) {
+		return false
+	}
+	if rp.ShardDuration != "" && !durationMatches(rp.ShardDuration, field["shardGroupDuration"]) {
+		return false
+	}
+	replication, ok := field["replicaN"].(json.Number)
+	if !ok || replication.String() != strconv.Itoa(rp.Replication) {
+		return false
+	}
+	isDefault, _ := field["default"].(bool)
+	return isDefault || !rp.Default
+}
+
+// durationMatches compares a duration written in InfluxQL with one shown by
+// InfluxDB, eg. '90d' and '2160h0m0s'.
+func durationMatches(configured string, shown interface{}) bool {
+	s, ok := shown.(string)
+	if !ok {
+		return false
+	}
+	want, err := ParseInfluxDuration(configured)
+	if err != nil {
+		return false
+	}
+	got, err := time.ParseDuration(s)
+	return err == nil && got == want
+}
+
+var influxDurationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"µ":  time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+var influxDurationPart = regexp.MustCompile(`^(\d+)(ns|u|µ|ms|s|m|h|d|w)`)
+
+// ParseInfluxDuration reads a duration literal of InfluxQL such as '90d' or
+// '1h30m'. INF stands for an infinite duration and is returned as 0, as
+// shown by InfluxDB.
+func ParseInfluxDuration(s string) (time.Duration, error) {
+	if strings.EqualFold(s, "INF") {
+		return 0, nil
+	}
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	var d time.Duration
+	for rest := s; rest != ""; {
+		m := influxDurationPart.FindStringSubmatch(rest)
+		if m == nil {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		d += time.Duration(n) * influxDurationUnits[m[2]]
+		rest = rest[len(m[0]):]
+	}
+	return d, nil
+}
+
+// EnsureContinuousQuery creates a continuous query. Since InfluxDB does not
+// allow to alter continuous queries, an existing query of the same name is
+// dropped first unless it is stored with the same statement. The statements
+// run are returned.
+func (i Influx) EnsureContinuousQuery(cq ContinuousQueryConf) ([]string, error) {
+	if cq.Name == "" || cq.Query == "" {
+		return nil, fmt.Errorf("continuous queries require a name and a query")
+	}
+	create := fmt.Sprintf("CREATE CONTINUOUS QUERY %s ON %s ", quoteIdent(cq.Name), quoteIdent(i.DB))
+	if cq.Every != "" || cq.For != "" {
+		create += "RESAMPLE "
+		if cq.Every != "" {
+			create += "EVERY " + cq.Every + " "
+		}
+		if cq.For != "" {
+			create += "FOR " + cq.For + " "
+		}
+	}
+	create += "BEGIN " + strings.TrimSpace(cq.Query) + " END"
+
+	res, err := i.Query("SHOW CONTINUOUS QUERIES")
+	if err != nil {
+		return nil, err
+	}
+	exists := false
+	for _, r := range res {
+		for _, s := range r.Series {
+			if s.Name != i.DB {
+				continue
+			}
+			query := -1
+			for n, c := range s.Columns {
+				if c == "query" {
+					query = n
+				}
+			}
+			for _, row := range s.Values {
+				if len(row) == 0 || row[0] != cq.Name {
+					continue
+				}
+				if query >= 0 && query < len(row) && row[query] == create {
+					return nil, nil
+				}
+				exists = true
+			}
+		}
+	}
+
+	var stmts []string
+	if exists {
+		stmts = append(stmts, fmt.Sprintf("DROP CONTINUOUS QUERY %s ON %s", quoteIdent(cq.Name), quoteIdent(i.DB)))
+	}
+	stmts = append(stmts, create)
+
+	for _, stmt := range stmts {
+		if _, err := i.Query(stmt); err != nil {
+			return stmts, fmt.Errorf("continuous query '%s': %s", cq.Name, err.Error())
+		}
+	}
+	return stmts, nil
+}
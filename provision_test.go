@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	tests := map[string]string{
+		"www":       `"www"`,
+		"www 90d":   `"www 90d"`,
+		`say "hi"`:  `"say \"hi\""`,
+		`back\path`: `"back\\path"`,
+	}
+	for in, expected := range tests {
+		if got := quoteIdent(in); got != expected {
+			t.Errorf("%s: expected %s, got %s", in, expected, got)
+		}
+	}
+}
+
+func TestParseInfluxDuration(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected time.Duration
+		err      bool
+	}{
+		{in: "INF", expected: 0},
+		{in: "inf", expected: 0},
+		{in: "90d", expected: 90 * 24 * time.Hour},
+		{in: "1w", expected: 7 * 24 * time.Hour},
+		{in: "1h30m", expected: 90 * time.Minute},
+		{in: "500ms", expected: 500 * time.Millisecond},
+		{in: "10u", expected: 10 * time.Microsecond},
+		{in: "2µ", expected: 2 * time.Microsecond},
+		{in: "7ns", expected: 7},
+		{in: "", err: true},
+		{in: "90", err: true},
+		{in: "d", err: true},
+		{in: "1y", err: true},
+		{in: "1h 30m", err: true},
+	}
+	for _, test := range tests {
+		d, err := ParseInfluxDuration(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", test.in, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err)
+		} else if d != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.in, test.expected, d)
+		}
+	}
+}
+
+var retentionPolicyColumns = []string{"name", "duration", "shardGroupDuration", "replicaN", "default"}
+
+func TestRetentionPolicyMatches(t *testing.T) {
+	rp := RetentionPolicyConf{Name: "www_90d", Duration: "90d", Replication: 1, ShardDuration: "1d"}
+	row := func(duration, shard string, replication string, isDefault bool) []interface{} {
+		return []interface{}{"www_90d", duration, shard, json.Number(replication), isDefault}
+	}
+	tests := []struct {
+		name     string
+		rp       func(RetentionPolicyConf) RetentionPolicyConf
+		row      []interface{}
+		expected bool
+	}{
+		{name: "same", row: row("2160h0m0s", "24h0m0s", "1", false), expected: true},
+		{name: "duration", row: row("720h0m0s", "24h0m0s", "1", false)},
+		{name: "shard duration", row: row("2160h0m0s", "168h0m0s", "1", false)},
+		{name: "replication", row: row("2160h0m0s", "24h0m0s", "2", false)},
+		{name: "made default", row: row("2160h0m0s", "24h0m0s", "1", false), rp: func(rp RetentionPolicyConf) RetentionPolicyConf {
+			rp.Default = true
+			return rp
+		}},
+		{name: "default already", row: row("2160h0m0s", "24h0m0s", "1", true), expected: true},
+		{name: "infinite", row: row("0s", "168h0m0s", "1", false), expected: true, rp: func(rp RetentionPolicyConf) RetentionPolicyConf {
+			rp.Duration = "INF"
+			rp.ShardDuration = "1w"
+			return rp
+		}},
+		{name: "shard duration not configured", row: row("2160h0m0s", "168h0m0s", "1", false), expected: true, rp: func(rp RetentionPolicyConf) RetentionPolicyConf {
+			rp.ShardDuration = ""
+			return rp
+		}},
+		{name: "invalid duration", row: row("2160h0m0s", "24h0m0s", "1", false), rp: func(rp RetentionPolicyConf) RetentionPolicyConf {
+			rp.Duration = "three months"
+			return rp
+		}},
+		{name: "short row", row: []interface{}{"www_90d", "2160h0m0s"}},
+	}
+	for _, test := range tests {
+		conf := rp
+		if test.rp != nil {
+			conf = test.rp(conf)
+		}
+		if got := retentionPolicyMatches(conf, retentionPolicyColumns, test.row); got != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestEnsureRetentionPolicy(t *testing.T) {
+	show := `{"results": [{"statement_id": 0, "series": [{"columns": ["name", "duration", "shardGroupDuration", "replicaN", "default"], "values": [["autogen", "0s", "168h0m0s", 1, true], ["www_90d", "2160h0m0s", "24h0m0s", 1, false]]}]}]}`
+	rp := RetentionPolicyConf{Name: "www_90d", Duration: "90d", Replication: 1, ShardDuration: "1d"}
+	tests := []struct {
+		name     string
+		rp       func(RetentionPolicyConf) RetentionPolicyConf
+		expected string
+	}{
+		{name: "up to date"},
+		{name: "altered", rp: func(rp RetentionPolicyConf) RetentionPolicyConf {
+			rp.Duration = "30d"
+			return rp
+		}, expected: `ALTER RETENTION POLICY "www_90d" ON "db" DURATION 30d REPLICATION 1 SHARD DURATION 1d`},
+		{name: "made default", rp: func(rp RetentionPolicyConf) RetentionPolicyConf {
+			rp.Default = true
+			return rp
+		}, expected: `ALTER RETENTION POLICY "www_90d" ON "db" DURATION 90d REPLICATION 1 SHARD DURATION 1d DEFAULT`},
+		{name: "created", rp: func(rp RetentionPolicyConf) RetentionPolicyConf {
+			rp.Name = "www_30d"
+			rp.Duration = "30d"
+			rp.ShardDuration = ""
+			return rp
+		}, expected: `CREATE RETENTION POLICY "www_30d" ON "db" DURATION 30d REPLICATION 1`},
+	}
+	for _, test := range tests {
+		f := newFakeInflux(show)
+		i := f.influx(t, "")
+		conf := rp
+		if test.rp != nil {
+			conf = test.rp(conf)
+		}
+		stmt, err := i.EnsureRetentionPolicy(conf)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if stmt != test.expected {
+			t.Errorf("%s: expected statement %q, got %q", test.name, test.expected, stmt)
+		}
+		queries := []string{`SHOW RETENTION POLICIES ON "db"`}
+		if test.expected != "" {
+			queries = append(queries, test.expected)
+		}
+		if len(f.queries) != len(queries) {
+			t.Errorf("%s: expected queries %q, got %q", test.name, queries, f.queries)
+			continue
+		}
+		for n := range queries {
+			if f.queries[n] != queries[n] {
+				t.Errorf("%s: expected query %q, got %q", test.name, queries[n], f.queries[n])
+			}
+		}
+	}
+}
+
+func TestEnsureContinuousQuery(t *testing.T) {
+	query := `SELECT sum(*) INTO "www_stats_1h" FROM "www_stats" GROUP BY time(1h), *`
+	stored, _ := json.Marshal(`CREATE CONTINUOUS QUERY "www_stats_1w" ON "db" BEGIN ` + query + ` END`)
+	show := `{"results": [{"statement_id": 0, "series": [{"name": "other", "columns": ["name", "query"], "values": [["www_stats_1d", "CREATE CONTINUOUS QUERY ..."]]}, {"name": "db", "columns": ["name", "query"], "values": [["www_stats_1h", "CREATE CONTINUOUS QUERY ..."], ["www_stats_1w", ` + string(stored) + `]]}]}]}`
+	tests := []struct {
+		name     string
+		cq       ContinuousQueryConf
+		expected []string
+		err      string
+	}{
+		{
+			name: "replaced",
+			cq:   ContinuousQueryConf{Name: "www_stats_1h", Query: query + "\n"},
+			expected: []string{
+				`DROP CONTINUOUS QUERY "www_stats_1h" ON "db"`,
+				`CREATE CONTINUOUS QUERY "www_stats_1h" ON "db" BEGIN ` + query + ` END`,
+			},
+		},
+		{
+			name: "created",
+			cq:   ContinuousQueryConf{Name: "www_stats_1d", Query: query, Every: "30m", For: "2h"},
+			expected: []string{
+				`CREATE CONTINUOUS QUERY "www_stats_1d" ON "db" RESAMPLE EVERY 30m FOR 2h BEGIN ` + query + ` END`,
+			},
+		},
+		{
+			name: "every only",
+			cq:   ContinuousQueryConf{Name: "www_stats_1d", Query: query, Every: "30m"},
+			expected: []string{
+				`CREATE CONTINUOUS QUERY "www_stats_1d" ON "db" RESAMPLE EVERY 30m BEGIN ` + query + ` END`,
+			},
+		},
+		{
+			name: "unchanged",
+			cq:   ContinuousQueryConf{Name: "www_stats_1w", Query: query},
+		},
+		{
+			name: "changed",
+			cq:   ContinuousQueryConf{Name: "www_stats_1w", Query: query, Every: "30m"},
+			expected: []string{
+				`DROP CONTINUOUS QUERY "www_stats_1w" ON "db"`,
+				`CREATE CONTINUOUS QUERY "www_stats_1w" ON "db" RESAMPLE EVERY 30m BEGIN ` + query + ` END`,
+			},
+		},
+		{
+			name: "no query",
+			cq:   ContinuousQueryConf{Name: "www_stats_1d"},
+			err:  "continuous queries require a name and a query",
+		},
+	}
+	for _, test := range tests {
+		f := newFakeInflux(show)
+		i := f.influx(t, "")
+		stmts, err := i.EnsureContinuousQuery(test.cq)
+		f.Close()
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if len(stmts) != len(test.expected) || len(f.queries) != len(stmts)+1 {
+			t.Errorf("%s: expected %q, got %q, queries run %q", test.name, test.expected, stmts, f.queries)
+			continue
+		}
+		for n := range stmts {
+			if stmts[n] != test.expected[n] {
+				t.Errorf("%s: expected %q, got %q", test.name, test.expected[n], stmts[n])
+			}
+			if f.queries[n+1] != stmts[n] {
+				t.Errorf("%s: expected %q to be run, got %q", test.name, stmts[n], f.queries[n+1])
+			}
+		}
+	}
+}
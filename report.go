@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/influxdata/influxdb/client/v2"
+)
+
+// RunReport summarizes a run of 'gulp'.
+type RunReport struct {
+	Indicator    string
+	Start        time.Time
+	End          time.Time
+	MarkerBefore time.Time
+	MarkerAfter  time.Time
+	Slices       int
+	// Queries is the number of queries run and processed.
+	Queries int
+	// EsTime is the time spent waiting for ElasticSearch, EsTook the sum of
+	// the 'took' reported by ElasticSearch in milliseconds.
+	EsTime time.Duration
+	EsTook float64
+	// Points holds the number of points produced by each iterator, keyed by
+	// the path of the iterator in the config.
+	Points         map[string]int
+	PointsProduced int
+	PointsWritten  int
+	// PointsDropped is the number of points of batches that could not be
+	// written.
+	PointsDropped int
+	Errors        []string
+}
+
+// reportDoc is the JSON representation of a RunReport.
+type reportDoc struct {
+	Indicator      string         `json:"indicator"`
+	Success        bool           `json:"success"`
+	Start          string         `json:"start"`
+	End            string         `json:"end"`
+	Duration       float64        `json:"duration_seconds"`
+	MarkerBefore   string         `json:"marker_before"`
+	MarkerAfter    string         `json:"marker_after"`
+	Slices         int            `json:"slices"`
+	Queries        int            `json:"queries"`
+	EsTime         float64        `json:"es_seconds"`
+	EsTook         float64        `json:"es_took_ms"`
+	Points         map[string]int `json:"points"`
+	PointsProduced int            `json:"points_produced"`
+	PointsWritten  int            `json:"points_written"`
+	PointsDropped  int            `json:"points_dropped"`
+	Errors         []string       `json:"errors"`
+}
+
+func (r RunReport) Success() bool {
+	return len(r.Errors) < 1
+}
+
+// Save writes the report as JSON to a file.
+func (r RunReport) Save(file string) error {
+	points := r.Points
+	if points == nil {
+		points = map[string]int{}
+	}
+	doc := reportDoc{
+		Indicator:      r.Indicator,
+		Success:        r.Success(),
+		Start:          formatTime(r.Start),
+		End:            formatTime(r.End),
+		Duration:       r.End.Sub(r.Start).Seconds(),
+		MarkerBefore:   formatTime(r.MarkerBefore),
+		MarkerAfter:    formatTime(r.MarkerAfter),
+		Slices:         r.Slices,
+		Queries:        r.Queries,
+		EsTime:         r.EsTime.Seconds(),
+		EsTook:         r.EsTook,
+		Points:         points,
+		PointsProduced: r.PointsProduced,
+		PointsWritten:  r.PointsWritten,
+		PointsDropped:  r.PointsDropped,
+		Errors:         append([]string{}, r.Errors...),
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not save report: %s", err.Error())
+	}
+	return nil
+}
+
+// Point returns the report as data point of the measurement 'series', tagged
+// with the indicator and whether the run succeeded. Markers are written as
+// unix timestamps, zero if unknown.
+func (r RunReport) Point(series string) (*client.Point, error) {
+	status := "ok"
+	if !r.Success() {
+		status = "error"
+	}
+	unix := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+	tags := map[string]string{
+		"ruminant": r.Indicator,
+		"status":   status,
+	}
+	fields := map[string]interface{}{
+		"duration":        r.End.Sub(r.Start).Seconds(),
+		"marker_before":   unix(r.MarkerBefore),
+		"marker_after":    unix(r.MarkerAfter),
+		"slices":          r.Slices,
+		"queries":         r.Queries,
+		"es_time":         r.EsTime.Seconds(),
+		"es_took":         r.EsTook,
+		"points_produced": r.PointsProduced,
+		"points_written":  r.PointsWritten,
+		"points_dropped":  r.PointsDropped,
+		"errors":          len(r.Errors),
+	}
+	return client.NewPoint(series, tags, fields, r.Start)
+}
+
+// WriteReport saves the report as data point of the measurement 'series'.
+func (i Influx) WriteReport(r RunReport, series string) error {
+	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
+		Database:        i.DB,
+		RetentionPolicy: i.RetentionPolicy,
+		Precision:       "s",
+	})
+	if err != nil {
+		return err
+	}
+	p, err := r.Point(series)
+	if err != nil {
+		return err
+	}
+	bp.AddPoint(p)
+	return i.Client.Write(bp)
+}
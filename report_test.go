@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testReport() RunReport {
+	start := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	return RunReport{
+		Indicator:      "www",
+		Start:          start,
+		End:            start.Add(90 * time.Second),
+		MarkerBefore:   start.Add(-2 * time.Hour),
+		MarkerAfter:    start.Add(-time.Hour),
+		Slices:         2,
+		Queries:        4,
+		EsTime:         1500 * time.Millisecond,
+		EsTook:         1200,
+		Points:         map[string]int{"ruminate.iterator": 10},
+		PointsProduced: 10,
+		PointsWritten:  6,
+		PointsDropped:  4,
+	}
+}
+
+func TestRunReportSave(t *testing.T) {
+	failed := testReport()
+	failed.Errors = []string{"could not write data to InfluxDB: point without fields is unsupported"}
+	empty := RunReport{Indicator: "www"}
+
+	tests := []struct {
+		name     string
+		report   RunReport
+		expected map[string]interface{}
+	}{
+		{
+			name:   "success",
+			report: testReport(),
+			expected: map[string]interface{}{
+				"indicator":        "www",
+				"success":          true,
+				"start":            "2020-09-01T10:00:00Z",
+				"end":              "2020-09-01T10:01:30Z",
+				"duration_seconds": 90.0,
+				"marker_before":    "2020-09-01T08:00:00Z",
+				"marker_after":     "2020-09-01T09:00:00Z",
+				"slices":           2.0,
+				"queries":          4.0,
+				"es_seconds":       1.5,
+				"es_took_ms":       1200.0,
+				"points":           map[string]interface{}{"ruminate.iterator": 10.0},
+				"points_produced":  10.0,
+				"points_written":   6.0,
+				"points_dropped":   4.0,
+				"errors":           []interface{}{},
+			},
+		},
+		{
+			name:   "failed",
+			report: failed,
+		},
+		{
+			name:   "empty",
+			report: empty,
+		},
+	}
+	for _, test := range tests {
+		f, err := ioutil.TempFile("", "report")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		err = test.report.Save(f.Name())
+		b, _ := ioutil.ReadFile(f.Name())
+		os.Remove(f.Name())
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			t.Errorf("%s: invalid JSON %s: %s", test.name, string(b), err)
+			continue
+		}
+		if _, ok := doc["dropped"]; ok {
+			t.Errorf("%s: expected no list of dropped points", test.name)
+		}
+		if test.expected != nil && !reflect.DeepEqual(doc, test.expected) {
+			t.Errorf("%s: expected\n%v\ngot\n%v", test.name, test.expected, doc)
+		}
+		if doc["success"] != test.report.Success() {
+			t.Errorf("%s: expected success %t, got %v", test.name, test.report.Success(), doc["success"])
+		}
+		if errors, ok := doc["errors"].([]interface{}); !ok || len(errors) != len(test.report.Errors) {
+			t.Errorf("%s: expected errors %q, got %v", test.name, test.report.Errors, doc["errors"])
+		}
+		if points, ok := doc["points"].(map[string]interface{}); !ok || points == nil {
+			t.Errorf("%s: expected points to be an object, got %v", test.name, doc["points"])
+		}
+	}
+}
+
+func TestRunReportPoint(t *testing.T) {
+	failed := testReport()
+	failed.Errors = []string{"failed"}
+	tests := []struct {
+		name   string
+		report RunReport
+		status string
+		fields map[string]interface{}
+	}{
+		{
+			name:   "success",
+			report: testReport(),
+			status: "ok",
+			fields: map[string]interface{}{
+				"marker_before":  int64(1598947200),
+				"marker_after":   int64(1598950800),
+				"points_written": int64(6),
+				"points_dropped": int64(4),
+				"errors":         int64(0),
+			},
+		},
+		{
+			name:   "failed",
+			report: failed,
+			status: "error",
+			fields: map[string]interface{}{"errors": int64(1)},
+		},
+		{
+			name:   "no markers",
+			report: RunReport{Indicator: "www", Start: time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)},
+			status: "ok",
+			fields: map[string]interface{}{"marker_before": int64(0), "marker_after": int64(0)},
+		},
+	}
+	for _, test := range tests {
+		p, err := test.report.Point("ruminant_runs")
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if p.Name() != "ruminant_runs" || !p.Time().Equal(test.report.Start) {
+			t.Errorf("%s: unexpected point %s", test.name, p.String())
+		}
+		if tags := p.Tags(); tags["ruminant"] != "www" || tags["status"] != test.status {
+			t.Errorf("%s: unexpected tags %v", test.name, tags)
+		}
+		fields, err := p.Fields()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		for key, expected := range test.fields {
+			if fields[key] != expected {
+				t.Errorf("%s: expected %s=%v, got %v (%T)", test.name, key, expected, fields[key], fields[key])
+			}
+		}
+	}
+}
@@ -1,98 +1,308 @@
 package main
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
-	"html/template"
-	"log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-func Ruminate(c Config, burp bool, l *zap.SugaredLogger) []Point {
-	l.Infow("Going to create InfluxDB client")
-	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
+// Digest is called by Ruminate once all queries of a slice are processed.
+// Returning errStop ends the run without an error.
+type Digest func(s Slice, points []Point) error
+
+// RuminateOpts controls how a run is performed.
+type RuminateOpts struct {
+	// Burp processes the responses up to the first point only and prints
+	// the json fragment processed last.
+	Burp bool
+	// SaveResponse is the file the responses of ElasticSearch are saved to.
+	// If more than one query is run, the number of the query is added to
+	// the file name.
+	SaveResponse string
+	// Report is filled with the statistics of the run unless it is nil.
+	Report *RunReport
+}
+
+// Ruminate queries ElasticSearch starting at the latest marker timestamp and
+// processes the results slice by slice in chronological order. The points of
+// each slice are passed to 'digest' before the next slice is processed.
+func Ruminate(c Config, o RuminateOpts, l *zap.SugaredLogger, digest Digest) error {
+	burp := o.Burp
+	es, latest, slices, err := plan(c, l)
 	if err != nil {
-		l.Fatal("Could net create InfluxDB client", "error", err.Error())
+		return err
+	}
+	if o.Report != nil {
+		o.Report.MarkerBefore = latest
+		o.Report.Slices = len(slices)
+		o.Report.Points = make(map[string]int)
 	}
 
-	l.Infow("Getting latest timestamp from InfluxDB")
-	latest, err := i.GetLatestMarker()
-	if err != nil {
-		l.Fatalw("Could not get latest timestamp in series. How you already prepared the database with 'init'?", "error", err.Error())
+	type queryJob struct {
+		slice  int
+		sample int
+		query  Query
 	}
-	l.Infof("Latest entry at %s", latest.Format("2006-01-02 15:04:05"))
+	var jobs []queryJob
+	for n, s := range slices {
+		for i, query := range s.Queries {
+			jobs = append(jobs, queryJob{slice: n, sample: i, query: query})
+		}
+	}
+	l.Infof("A total of %d queries in %d slices are built", len(jobs), len(slices))
 
-	es := NewElasticSearch(c.Regurgitate.Proto, c.Regurgitate.Host, c.Regurgitate.Port)
+	type jobResult struct {
+		points       []Point
+		jsonFragment string
+		esTime       time.Duration
+		took         float64
+		counts       map[string]int
+	}
 
-	sampledQueries := make(map[time.Time][]string)
-	interv := c.Regurgitate.Sampler.Interval
-	if interv != "" {
-		l.Infow("Sampler found, building queries")
-		s, err := NewSampler(c.Regurgitate.Sampler)
-		if err != nil {
-			l.Fatalw("Error occurred", "error", err.Error())
-		}
-		sampledQueries = s.BuildQueries(c.Regurgitate.Query, latest)
-		l.Infof("A total of %d queries are built", len(sampledQueries)*c.Regurgitate.Sampler.Samples)
-	} else {
-		l.Infow("No sampler config found, building simple query")
-		t := template.Must(template.New("t1").Parse(c.Regurgitate.Query))
-		var query bytes.Buffer
-		t.Execute(&query, ToEsTimestamp(latest))
-		sampledQueries[latest] = []string{query.String()}
+	workers := c.Regurgitate.Concurrency
+	if burp {
+		workers = 1
 	}
+	pool := NewPool(workers, c.Regurgitate.MaxQps)
+	l.Infof("Running queries with %d workers", pool.Workers)
 
-	var points []Point
-	processed := 0
-	for ts, queries := range sampledQueries {
-		if burp && len(points) > 0 {
-			break
+	work := func(n int) (interface{}, error) {
+		job := jobs[n]
+		s := slices[job.slice]
+		l.Infof("-- Query ElasticSearch @ %s for sample %d", s.At.Format("2006-01-02 15:04:05"), job.sample)
+		start := time.Now()
+		result, err := es.QueryAll(job.query.Index, c.Regurgitate.Type, job.query.Body, c.Regurgitate.Paging)
+		if err != nil {
+			return nil, fmt.Errorf("query failed: %s", err.Error())
 		}
-		var samples []Point
-		l.Infof("Sampling @ %s", ts.Format("2006-01-02 15:04:05"))
-		for i, query := range queries {
-			l.Infof("-- Query ElasticSearch for sample %d", i)
-			result, err := es.Query(c.Regurgitate.Index, c.Regurgitate.Type, query)
-			if err != nil {
-				l.Fatalw("-- Query failed", "error", err.Error())
-			}
-			j, err := result.AggsAsJson()
-			if err != nil {
-				log.Fatal(err)
+		res := jobResult{esTime: time.Since(start), took: result.Took}
+		if o.SaveResponse != "" {
+			file := o.SaveResponse
+			if len(jobs) > 1 {
+				file = numberedFile(file, n+1)
 			}
-			p := Point{
-				Timestamp: ts,
-				Tags:      make(map[string]string),
-				Values:    make(map[string]interface{}),
+			l.Infof("Saving response to %s", file)
+			if err := saveResponse(file, result); err != nil {
+				return nil, err
 			}
-			l.Infow("-- Processing results")
-			var sample []Point
-			var jsonFragment string
-			if burp {
-				l.Infow("Printing latest processed json fragment")
-				sample, jsonFragment, err = Burp(j, c.Ruminate.Iterator, p)
-				if jsonFragment != "" {
-					fmt.Printf("\n%s\n\n", jsonFragment)
-				}
-			} else {
-				sample, err = Chew(j, c.Ruminate.Iterator, p)
-			}
-			if err != nil {
-				l.Fatalw("Could not process data", "error", err.Error())
+		}
+		if o.Report != nil {
+			res.counts = make(map[string]int)
+		}
+		res.points, res.jsonFragment, err = ruminateResponse(c, result, s.At, burp, res.counts)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	var samples []Point
+	emit := func(n int, r interface{}) error {
+		job := jobs[n]
+		res := r.(jobResult)
+		if burp && res.jsonFragment != "" {
+			l.Infow("Printing latest processed json fragment")
+			fmt.Fprintf(os.Stderr, "\n%s\n\n", res.jsonFragment)
+		}
+		samples = append(samples, res.points...)
+		if o.Report != nil {
+			o.Report.Queries++
+			o.Report.EsTime += res.esTime
+			o.Report.EsTook += res.took
+			for path, count := range res.counts {
+				o.Report.Points[path] += count
+				o.Report.PointsProduced += count
 			}
-			samples = append(samples, sample...)
-			processed += 1
+		}
+		s := slices[job.slice]
+		if job.sample < len(s.Queries)-1 {
+			return nil
 		}
 
 		if c.Regurgitate.Sampler.Samples > 1 {
 			l.Infow("-- Calculating average of samples")
 			samples = Avg(samples, c.Regurgitate.Sampler.Samples)
 		}
-		points = append(points, samples...)
-		l.Infof("%d of %d queries run and processed", processed, len(sampledQueries)*c.Regurgitate.Sampler.Samples)
+		l.Infof("%d of %d queries run and processed", n+1, len(jobs))
+		points := samples
+		samples = nil
+		return digest(s, points)
 	}
 
-	return points
+	return pool.Run(len(jobs), work, emit)
+}
+
+// RuminateFile processes a response read from a file instead of querying
+// ElasticSearch. If 'input' is '-', the response is read from stdin. Points
+// without a time selector are timestamped with the current time.
+func RuminateFile(c Config, input string, burp bool, l *zap.SugaredLogger, digest Digest) error {
+	in, err := openInput(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	l.Infof("Reading response from %s", input)
+	result, err := NewEsResponse(in)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	points, jsonFragment, err := ruminateResponse(c, result, now, burp, nil)
+	if err != nil {
+		return err
+	}
+	if burp && jsonFragment != "" {
+		l.Infow("Printing latest processed json fragment")
+		fmt.Fprintf(os.Stderr, "\n%s\n\n", jsonFragment)
+	}
+	err = digest(Slice{At: now, From: now, To: now}, points)
+	if err == errStop {
+		return nil
+	}
+	return err
+}
+
+// openInput opens a file to read a response from, '-' refers to stdin.
+func openInput(input string) (*os.File, error) {
+	if input == "-" {
+		return os.Stdin, nil
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		return nil, fmt.Errorf("could not open input: %s", err.Error())
+	}
+	return f, nil
+}
+
+// ruminateResponse runs the iterators on a response, points are timestamped
+// with 'at' unless the iterators select a time. Unless 'counts' is nil, the
+// number of points produced by each iterator is added to it.
+func ruminateResponse(c Config, result EsResponse, at time.Time, burp bool, counts map[string]int) ([]Point, string, error) {
+	j, err := result.Root(c.Ruminate.Root)
+	if err != nil {
+		return nil, "", err
+	}
+	p := Point{
+		Timestamp: at,
+		Tags:      make(map[string]string),
+		Values:    make(map[string]interface{}),
+	}
+	var points []Point
+	var jsonFragment string
+	if burp {
+		points, jsonFragment, err = Burp(j, c.Ruminate.Iterator, p)
+	} else {
+		points, err = ChewCounted(j, c.Ruminate.Iterator, p, counts)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("could not process data: %s", err.Error())
+	}
+	return points, jsonFragment, nil
+}
+
+// saveResponse writes a response to a file so it can be processed offline
+// later on, eg. via '--input' or 'ruminant test'.
+func saveResponse(file string, r EsResponse) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not save response: %s", err.Error())
+	}
+	return nil
+}
+
+// numberedFile adds a number to a file name, eg. 'response.json' becomes
+// 'response.0001.json'.
+func numberedFile(file string, n int) string {
+	ext := filepath.Ext(file)
+	return fmt.Sprintf("%s.%04d%s", strings.TrimSuffix(file, ext), n, ext)
+}
+
+// plan connects to ElasticSearch and builds the slices to be queried starting
+// at the latest marker timestamp, which is returned as well.
+func plan(c Config, l *zap.SugaredLogger) (*ElasticSearch, time.Time, []Slice, error) {
+	l.Infow("Going to create InfluxDB client")
+	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.RetentionPolicy.Name, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
+	if err != nil {
+		return nil, time.Time{}, nil, fmt.Errorf("could not create InfluxDB client: %s", err.Error())
+	}
+
+	l.Infow("Getting latest timestamp from InfluxDB")
+	latest, err := i.GetLatestMarker()
+	if err != nil {
+		return nil, time.Time{}, nil, fmt.Errorf("could not get latest timestamp in series, have you already prepared the database with 'init'? %s", err.Error())
+	}
+	l.Infof("Latest entry at %s", latest.Format("2006-01-02 15:04:05"))
+
+	es := NewElasticSearchTimeout(c.Regurgitate.NodeUrls(), c.Regurgitate.Timeout)
+	if c.Regurgitate.Sniff {
+		l.Infow("Sniffing ElasticSearch nodes")
+		nodes, err := es.Sniff()
+		if err != nil {
+			return nil, time.Time{}, nil, fmt.Errorf("could not sniff ElasticSearch nodes: %s", err.Error())
+		}
+		l.Infof("Using %d ElasticSearch nodes", len(nodes))
+	}
+	info, err := es.Detect()
+	if err != nil {
+		return nil, time.Time{}, nil, fmt.Errorf("could not detect ElasticSearch version: %s", err.Error())
+	}
+	l.Infof("Connected to %s", info)
+
+	qt, err := NewQueryTemplate(c)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	es.IgnoreUnavailable = qt.DynamicIndex()
+
+	var slices []Slice
+	end := time.Now().Add(-c.Regurgitate.Sampler.Offset)
+	if c.Regurgitate.Sampler.Interval != "" {
+		l.Infow("Sampler found, building queries")
+		s, err := NewSampler(c.Regurgitate.Sampler)
+		if err != nil {
+			return nil, time.Time{}, nil, err
+		}
+		slices, err = s.BuildSlices(qt, latest)
+		if err != nil {
+			return nil, time.Time{}, nil, err
+		}
+	} else if c.Regurgitate.Chunk > 0 {
+		l.Infof("Chunk size of %s found, building queries", c.Regurgitate.Chunk)
+		slices, err = BuildChunks(qt, latest, end, c.Regurgitate.Chunk)
+		if err != nil {
+			return nil, time.Time{}, nil, err
+		}
+	} else {
+		l.Infow("No sampler or chunk configured, the whole time range is queried at once and the marker is advanced once it is saved")
+		slices, err = BuildSlice(qt, latest, end)
+		if err != nil {
+			return nil, time.Time{}, nil, err
+		}
+	}
+
+	return &es, latest, slices, nil
+}
+
+// FetchResponse runs the first query of a run and returns its response.
+func FetchResponse(c Config, l *zap.SugaredLogger) (EsResponse, error) {
+	es, _, slices, err := plan(c, l)
+	if err != nil {
+		return EsResponse{}, err
+	}
+	if len(slices) < 1 || len(slices[0].Queries) < 1 {
+		return EsResponse{}, fmt.Errorf("no queries to run since the latest marker timestamp")
+	}
+	s := slices[0]
+	l.Infof("-- Query ElasticSearch @ %s", s.At.Format("2006-01-02 15:04:05"))
+	return es.QueryAll(s.Queries[0].Index, c.Regurgitate.Type, s.Queries[0].Body, c.Regurgitate.Paging)
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNumberedFile(t *testing.T) {
+	tests := []struct {
+		file string
+		n    int
+		out  string
+	}{
+		{"response.json", 1, "response.0001.json"},
+		{"/tmp/out/response.json", 12, "/tmp/out/response.0012.json"},
+		{"response", 3, "response.0003"},
+		{"response.tar.gz", 10000, "response.tar.10000.gz"},
+	}
+	for _, test := range tests {
+		if out := numberedFile(test.file, test.n); out != test.out {
+			t.Errorf("%s %d: expected %s, got %s", test.file, test.n, test.out, out)
+		}
+	}
+}
+
+func TestRuminateFile(t *testing.T) {
+	c := DefaultConf()
+	c.Ruminate.Iterator = Iterator{
+		Selector: ".by_host.buckets[]",
+		Tags:     map[string]string{"host": ".key"},
+		Values:   map[string]string{"count": ".doc_count"},
+	}
+	response := `{"took": 3, "aggregations": {"by_host": {"buckets": [
+		{"key": "a", "doc_count": 2},
+		{"key": "b", "doc_count": 5}
+	]}}}`
+	f, err := ioutil.TempFile("", "ruminant-response-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(response)
+	f.Close()
+
+	ruminate := func(input string) []Point {
+		var points []Point
+		err := RuminateFile(c, input, false, zap.New(nil).Sugar(), func(s Slice, p []Point) error {
+			points = append(points, p...)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return points
+	}
+	points := ruminate(f.Name())
+	counts := map[string]float64{}
+	for _, p := range points {
+		counts[p.Tags["host"]] = p.Values["count"].(float64)
+	}
+	if !reflect.DeepEqual(counts, map[string]float64{"a": 2, "b": 5}) {
+		t.Errorf("unexpected points %v", points)
+	}
+
+	// a saved response is processed the same way
+	var res EsResponse
+	res, err = NewEsResponse(strings.NewReader(response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := f.Name() + ".saved"
+	defer os.Remove(saved)
+	if err := saveResponse(saved, res); err != nil {
+		t.Fatal(err)
+	}
+	again := ruminate(saved)
+	if len(again) != len(points) {
+		t.Fatalf("expected %d points from the saved response, got %d", len(points), len(again))
+	}
+	for n := range points {
+		if !reflect.DeepEqual(again[n].Tags, points[n].Tags) || !reflect.DeepEqual(again[n].Values, points[n].Values) {
+			t.Errorf("expected %v, got %v", points[n], again[n])
+		}
+	}
+
+	if err := RuminateFile(c, f.Name()+".missing", false, zap.New(nil).Sugar(), nil); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
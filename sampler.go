@@ -1,14 +1,13 @@
 package main
 
 import (
-	"bytes"
-	"html/template"
 	"time"
 
 	"gopkg.in/robfig/cron.v2"
 )
 
 type Sampler struct {
+	spec          string
 	interval      cron.Schedule
 	offset        time.Duration
 	sampleOffsets []time.Duration
@@ -16,10 +15,11 @@ type Sampler struct {
 
 func NewSampler(c SamplerConfig) (Sampler, error) {
 	s := Sampler{
+		spec:   c.Interval,
 		offset: c.Offset,
 	}
 
-	interv, err := cron.Parse(c.Interval)
+	interv, err := ParseCron(c.Interval)
 	if err != nil {
 		return s, err
 	}
@@ -62,17 +62,34 @@ func (s Sampler) Iterate(from time.Time) []time.Time {
 	return out
 }
 
-func (s Sampler) BuildQueries(templ string, start time.Time) map[time.Time][]string {
-	t := template.Must(template.New("query").Parse(templ))
-	out := make(map[time.Time][]string)
+// BuildSlices returns one slice per interval. Each slice contains a query
+// per sample.
+func (s Sampler) BuildSlices(qt QueryTemplate, start time.Time) ([]Slice, error) {
+	var out []Slice
+	from := start
 	for _, at := range s.Iterate(start) {
-		var queries []string
+		var queries []Query
 		for _, offset := range s.sampleOffsets {
-			var query bytes.Buffer
-			t.Execute(&query, ToEsTimestamp(at.Add(offset)))
-			queries = append(queries, query.String())
+			qc := qt.Context()
+			qc.Timestamp = at.Add(offset)
+			qc.From = from.Add(offset)
+			qc.To = at.Add(offset)
+			qc.SampleOffset = offset
+			qc.Interval = s.spec
+			query, err := qt.Render(qc)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, query)
 		}
-		out[at] = queries
+		out = append(out, Slice{
+			At:      at,
+			From:    from,
+			To:      at,
+			Queries: queries,
+			Marker:  at,
+		})
+		from = at
 	}
-	return out
+	return out, nil
 }
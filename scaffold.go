@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Aggregations returning a list of buckets. Date histograms provide the time
+// of the data points, the keys of all others are used as tags.
+var (
+	timeBucketAggs = map[string]bool{"date_histogram": true, "auto_date_histogram": true}
+	tagBucketAggs  = map[string]bool{"terms": true, "significant_terms": true, "rare_terms": true, "histogram": true, "range": true, "date_range": true, "ip_range": true}
+)
+
+// Aggregations returning a single bucket.
+var singleBucketAggs = map[string]bool{"filter": true, "nested": true, "reverse_nested": true, "global": true, "missing": true, "sampler": true}
+
+// Aggregations returning a single value in 'value'.
+var valueMetricAggs = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "cardinality": true, "value_count": true, "median_absolute_deviation": true, "weighted_avg": true}
+
+var (
+	statsFields         = []string{"count", "min", "max", "avg", "sum"}
+	extendedStatsFields = []string{"count", "min", "max", "avg", "sum", "sum_of_squares", "variance", "std_deviation"}
+	defaultPercents     = []float64{1, 5, 25, 50, 75, 95, 99}
+)
+
+var jeeIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Scaffold builds an iterator matching the aggregations of a query. Bucket
+// aggregations become iterators, metrics become values. Aggregations that
+// are not supported are reported as warnings. If 'root' is 'response', the
+// selectors start at the whole response instead of the aggregations.
+func Scaffold(query []byte, root string) (Iterator, []string, error) {
+	var q map[string]interface{}
+	if err := json.Unmarshal(query, &q); err != nil {
+		return Iterator{}, nil, fmt.Errorf("query is not valid JSON: %s", err.Error())
+	}
+	aggs := subAggs(q)
+	if len(aggs) < 1 {
+		return Iterator{}, nil, fmt.Errorf("query has no aggregations")
+	}
+
+	s := &scaffolder{}
+	path := ""
+	if root == RootResponse {
+		path = ".aggregations"
+	}
+	iterators, values := s.walk(aggs, path, "")
+	if len(iterators) < 1 {
+		return Iterator{}, s.warnings, fmt.Errorf("query has no bucket aggregation to iterate over")
+	}
+	for _, name := range sortedKeys(values) {
+		s.warn("metric '%s' is not within a bucket aggregation and is skipped", name)
+	}
+	// prefer an aggregation providing the time of the data points
+	chosen := 0
+	for n, i := range iterators {
+		if i.Time != "" {
+			chosen = n
+			break
+		}
+	}
+	for n, i := range iterators {
+		if n != chosen {
+			s.warn("only one aggregation can be iterated at the top level, '%s' is skipped", i.Selector)
+		}
+	}
+	return iterators[chosen], s.warnings, nil
+}
+
+type scaffolder struct {
+	warnings []string
+}
+
+func (s *scaffolder) warn(format string, args ...interface{}) {
+	s.warnings = append(s.warnings, fmt.Sprintf(format, args...))
+}
+
+// walk returns the iterators and values for the aggregations given. 'path' is
+// the selector of the object containing the aggregations, 'prefix' is added
+// to the names of values found in single bucket aggregations.
+func (s *scaffolder) walk(aggs map[string]interface{}, path, prefix string) ([]Iterator, map[string]string) {
+	var iterators []Iterator
+	values := make(map[string]string)
+
+	names := make([]string, 0, len(aggs))
+	for name := range aggs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		def, _ := aggs[name].(map[string]interface{})
+		kind, body := aggType(def)
+		sel := jeeSelect(path, name)
+
+		switch {
+		case timeBucketAggs[kind] || tagBucketAggs[kind] || kind == "composite" || (kind == "filters" && !namedFilters(body)):
+			i := Iterator{Selector: sel + ".buckets[]"}
+			switch {
+			case timeBucketAggs[kind]:
+				i.Time = ".key"
+			case kind == "composite":
+				i.Tags = make(map[string]string)
+				sources, _ := body["sources"].([]interface{})
+				for n, src := range sources {
+					source, ok := src.(map[string]interface{})
+					if !ok {
+						s.warn("source %d of composite aggregation '%s' is not an object and is skipped", n, name)
+						continue
+					}
+					for key := range source {
+						i.Tags[key] = jeeSelect(".key", key)
+					}
+				}
+			case tagBucketAggs[kind]:
+				i.Tags = map[string]string{name: ".key"}
+			}
+			i.Iterators, i.Values = s.walk(subAggs(def), "", "")
+			if len(i.Iterators) < 1 {
+				i.Values[prefix+name+"_count"] = ".doc_count"
+			}
+			if len(i.Values) < 1 {
+				i.Values = nil
+			}
+			iterators = append(iterators, i)
+		case kind == "filters":
+			for _, filter := range keysOf(body["filters"]) {
+				p := prefix + name + "_" + filter + "_"
+				fsel := jeeSelect(sel+".buckets", filter)
+				values[strings.TrimSuffix(p, "_")+"_count"] = fsel + ".doc_count"
+				s.merge(&iterators, values, subAggs(def), fsel, p)
+			}
+		case singleBucketAggs[kind]:
+			values[prefix+name+"_count"] = sel + ".doc_count"
+			s.merge(&iterators, values, subAggs(def), sel, prefix+name+"_")
+		case valueMetricAggs[kind]:
+			values[prefix+name] = sel + ".value"
+		case kind == "stats":
+			for _, f := range statsFields {
+				values[prefix+name+"_"+f] = sel + "." + f
+			}
+		case kind == "extended_stats":
+			for _, f := range extendedStatsFields {
+				values[prefix+name+"_"+f] = sel + "." + f
+			}
+		case kind == "percentiles":
+			percents := defaultPercents
+			if list, ok := body["percents"].([]interface{}); ok {
+				percents = nil
+				for _, p := range list {
+					if f, ok := p.(float64); ok {
+						percents = append(percents, f)
+					}
+				}
+			}
+			for _, p := range percents {
+				// percentiles are keyed as doubles, eg. '95.0'
+				key := strconv.FormatFloat(p, 'f', -1, 64)
+				suffix := strings.Replace(key, ".", "_", -1)
+				if !strings.Contains(key, ".") {
+					key += ".0"
+				}
+				values[prefix+name+"_p"+suffix] = jeeSelect(sel+".values", key)
+			}
+		default:
+			s.warn("aggregation '%s' of type '%s' is not supported and is skipped", name, kind)
+		}
+	}
+	return iterators, values
+}
+
+// merge adds the iterators and values of nested aggregations.
+func (s *scaffolder) merge(iterators *[]Iterator, values map[string]string, aggs map[string]interface{}, path, prefix string) {
+	its, vals := s.walk(aggs, path, prefix)
+	*iterators = append(*iterators, its...)
+	for key, value := range vals {
+		values[key] = value
+	}
+}
+
+// subAggs returns the aggregations nested in a query or aggregation.
+func subAggs(def map[string]interface{}) map[string]interface{} {
+	if aggs, ok := def["aggs"].(map[string]interface{}); ok {
+		return aggs
+	}
+	aggs, _ := def["aggregations"].(map[string]interface{})
+	return aggs
+}
+
+// aggType returns the type and the body of an aggregation definition.
+func aggType(def map[string]interface{}) (string, map[string]interface{}) {
+	for key, value := range def {
+		switch key {
+		case "aggs", "aggregations", "meta":
+			continue
+		}
+		body, _ := value.(map[string]interface{})
+		return key, body
+	}
+	return "", nil
+}
+
+// namedFilters indicates whether the filters of a 'filters' aggregation are
+// named, in which case the buckets are returned as object instead of a list.
+func namedFilters(body map[string]interface{}) bool {
+	_, ok := body["filters"].(map[string]interface{})
+	return ok
+}
+
+// jeeSelect returns the selector of a key within the object selected by
+// 'path'. Bracket notation is used if the key contains special characters.
+func jeeSelect(path, key string) string {
+	if jeeIdentifier.MatchString(key) {
+		return path + "." + key
+	}
+	if path == "" {
+		path = "."
+	}
+	return path + `["` + strings.Replace(key, `"`, `\"`, -1) + `"]`
+}
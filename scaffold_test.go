@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScaffold(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		root     string
+		iterator Iterator
+		warnings []string
+	}{
+		{
+			"terms",
+			`{"aggs": {"hosts": {"terms": {"field": "host"}, "aggs": {"bytes": {"sum": {"field": "bytes"}}}}}}`,
+			RootAggregations,
+			Iterator{
+				Selector: ".hosts.buckets[]",
+				Tags:     map[string]string{"hosts": ".key"},
+				Values:   map[string]string{"bytes": ".bytes.value", "hosts_count": ".doc_count"},
+			},
+			nil,
+		},
+		{
+			"date_histogram",
+			`{"aggs": {"over_time": {"date_histogram": {"field": "@timestamp", "interval": "1h"}, "aggs": {
+				"by_domain": {"terms": {"field": "domain"}, "aggs": {"latency": {"percentiles": {"field": "ms", "percents": [50, 99.9]}}}},
+				"geo_bounds": {"geo_bounds": {"field": "loc"}}
+			}}}}`,
+			RootResponse,
+			Iterator{
+				Selector: ".aggregations.over_time.buckets[]",
+				Time:     ".key",
+				Iterators: []Iterator{{
+					Selector: ".by_domain.buckets[]",
+					Tags:     map[string]string{"by_domain": ".key"},
+					Values: map[string]string{
+						"by_domain_count": ".doc_count",
+						"latency_p50":     `.latency.values["50.0"]`,
+						"latency_p99_9":   `.latency.values["99.9"]`,
+					},
+				}},
+			},
+			[]string{"aggregation 'geo_bounds' of type 'geo_bounds' is not supported and is skipped"},
+		},
+		{
+			"composite",
+			`{"aggs": {"pairs": {"composite": {"sources": [{"host": {"terms": {"field": "host"}}}, {"day-of-week": {"terms": {"field": "dow"}}}]}}}}`,
+			RootAggregations,
+			Iterator{
+				Selector: ".pairs.buckets[]",
+				Tags:     map[string]string{"host": ".key.host", "day-of-week": `.key["day-of-week"]`},
+				Values:   map[string]string{"pairs_count": ".doc_count"},
+			},
+			nil,
+		},
+		{
+			"malformed composite",
+			`{"aggs": {"c": {"composite": {"sources": ["bad", {"host": {"terms": {"field": "host"}}}]}}}}`,
+			RootAggregations,
+			Iterator{
+				Selector: ".c.buckets[]",
+				Tags:     map[string]string{"host": ".key.host"},
+				Values:   map[string]string{"c_count": ".doc_count"},
+			},
+			[]string{"source 0 of composite aggregation 'c' is not an object and is skipped"},
+		},
+	}
+	for _, test := range tests {
+		i, warnings, err := Scaffold([]byte(test.query), test.root)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(i, test.iterator) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.iterator, i)
+		}
+		if !reflect.DeepEqual(warnings, test.warnings) {
+			t.Errorf("%s: expected warnings %v, got %v", test.name, test.warnings, warnings)
+		}
+	}
+}
+
+func TestScaffoldErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{`{"aggs": `, "query is not valid JSON"},
+		{`{"size": 0}`, "query has no aggregations"},
+		{`{"aggs": {"total": {"sum": {"field": "bytes"}}}}`, "query has no bucket aggregation to iterate over"},
+		{`{"aggs": {"c": {"composite": {"sources": "bad"}}}}`, ""},
+	}
+	for _, test := range tests {
+		_, _, err := Scaffold([]byte(test.query), RootAggregations)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %s", test.query, err.Error())
+		case test.err != "" && (err == nil || !strings.HasPrefix(err.Error(), test.err)):
+			t.Errorf("%s: expected error '%s', got %v", test.query, test.err, err)
+		}
+	}
+}
+
+func TestJeeSelect(t *testing.T) {
+	tests := []struct {
+		path, key, sel string
+	}{
+		{".key", "host", ".key.host"},
+		{"", "hosts", ".hosts"},
+		{".values", "95.0", `.values["95.0"]`},
+		{"", "a-b", `.["a-b"]`},
+		{".x", `say "hi"`, `.x["say \"hi\""]`},
+	}
+	for _, test := range tests {
+		if sel := jeeSelect(test.path, test.key); sel != test.sel {
+			t.Errorf("%s %s: expected %s, got %s", test.path, test.key, test.sel, sel)
+		}
+	}
+}
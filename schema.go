@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// durationPattern matches durations as understood by time.ParseDuration.
+const durationPattern = `^-?(0|([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+)$`
+
+// Schema is the subset of JSON Schema required to describe the configuration.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// schemaDescriptions documents every key of the configuration. Keys are
+// written as the name of the struct followed by the YAML name of the field.
+// ConfigSchema fails if a field is not documented here, or if a description
+// does not match a field anymore.
+var schemaDescriptions = map[string]string{
+	"Config.name":        "Name of the pipeline, defaults to the indicator.",
+	"Config.regurgitate": "How to query ElasticSearch.",
+	"Config.ruminate":    "How to process the results of the query into data points.",
+	"Config.gulp":        "The InfluxDB the data points are written to.",
+	"Config.poop":        "How to dump data from InfluxDB.",
+
+	"RegurgitateConf.host":        "Host name of the ElasticSearch node.",
+	"RegurgitateConf.port":        "Port of the ElasticSearch node.",
+	"RegurgitateConf.proto":       "Protocol used to connect to the ElasticSearch node.",
+	"RegurgitateConf.nodes":       "URLs of the ElasticSearch nodes, overrides 'proto', 'host' and 'port'.",
+	"RegurgitateConf.sniff":       "Fetch the list of nodes from the cluster on startup, the credentials of the first node are used for all of them.",
+	"RegurgitateConf.index":       "Index to query, may contain a date format such as 'logstash-{yyyy.MM.dd}'.",
+	"RegurgitateConf.timezone":    "Time zone used to format the date of the index pattern.",
+	"RegurgitateConf.type":        "Document type to query, ignored by clusters without mapping types.",
+	"RegurgitateConf.query":       "The query, rendered as Go template before it is sent.",
+	"RegurgitateConf.paging":      "How to page through search hits.",
+	"RegurgitateConf.concurrency": "Number of queries run concurrently.",
+	"RegurgitateConf.max_qps":     "Maximum number of queries started per second, 0 means unlimited.",
+	"RegurgitateConf.timeout":     "Time a node may take to respond before the request is retried on the next node, 0 means no timeout.",
+	"RegurgitateConf.chunk":       "Split the time range into chunks of the given duration, the marker is advanced after each chunk. Without chunks the marker is only advanced at the end of the run.",
+	"RegurgitateConf.vars":        "Variables available as '.Vars' in the query template.",
+	"RegurgitateConf.sampler":     "Execute the query once per interval of a cron spec.",
+
+	"SamplerConfig.offset":        "Stop sampling the given duration before the current time. Also ends the time range processed in chunks or at once if no interval is set.",
+	"SamplerConfig.samples":       "Number of samples taken per interval, the results are averaged.",
+	"SamplerConfig.sample_offset": "Time between the samples of an interval.",
+	"SamplerConfig.interval":      "Cron spec of the intervals sampled, eg. '*/5 * * * *'.",
+
+	"RuminateConf.root":     "Whether the iterator starts at the aggregations or at the whole response.",
+	"RuminateConf.iterator": "The iterator that builds the data points.",
+
+	"Iterator.lang":         "Language of the expressions, defaults to the language of the parent iterator or 'jee'.",
+	"Iterator.selector":     "Expression selecting the array to iterate over.",
+	"Iterator.time":         "Expression selecting the timestamp of the data points.",
+	"Iterator.tags":         "Tags of the data points as expressions.",
+	"Iterator.fixed_tags":   "Tags of the data points with fixed values.",
+	"Iterator.values":       "Values of the data points as expressions.",
+	"Iterator.fixed_values": "Values of the data points with fixed values.",
+	"Iterator.iterators":    "Nested iterators, run for every element selected.",
+
+	"GulpConf.host":               "Host name of the InfluxDB.",
+	"GulpConf.port":               "Port of the InfluxDB.",
+	"GulpConf.db":                 "Name of the database.",
+	"GulpConf.proto":              "Protocol used to connect to the InfluxDB.",
+	"GulpConf.series":             "Name of the measurement the data points are written to.",
+	"GulpConf.user":               "User name used to connect to the InfluxDB.",
+	"GulpConf.pass":               "Password used to connect to the InfluxDB.",
+	"GulpConf.pass_file":          "File to read the password from.",
+	"GulpConf.indicator":          "Tag identifying the marker timestamps of this configuration.",
+	"GulpConf.retention_policy":   "Retention policy the data points and markers are written to, created by 'init'.",
+	"GulpConf.continuous_queries": "Continuous queries created by 'init', eg. to downsample the data points.",
+	"GulpConf.run_series":         "Measurement a summary of every run of 'gulp' is written to, eg. 'ruminant_runs'. Leave empty to disable.",
+
+	"RetentionPolicyConf.name":           "Name of the retention policy, the default policy of the database is used if empty.",
+	"RetentionPolicyConf.duration":       "How long data is kept as InfluxQL duration, eg. '90d' or 'INF'.",
+	"RetentionPolicyConf.replication":    "Number of copies of the data kept in a cluster.",
+	"RetentionPolicyConf.shard_duration": "Time range covered by a shard group, defaults to the choice of InfluxDB.",
+	"RetentionPolicyConf.default":        "Whether the retention policy is made the default of the database.",
+
+	"ContinuousQueryConf.name":  "Name of the continuous query.",
+	"ContinuousQueryConf.query": "'SELECT ... INTO ... GROUP BY time(...)' statement run by the continuous query.",
+	"ContinuousQueryConf.every": "How often the query runs, eg. '30m', defaults to the interval of 'GROUP BY time()'.",
+	"ContinuousQueryConf.for":   "Time range covered by each run, eg. '2h', defaults to the interval of 'GROUP BY time()'.",
+
+	"PoopConf.query":         "InfluxQL query rendered as Go template.",
+	"PoopConf.fields":        "Fields to dump, defaults to the time, tags and values of the iterator.",
+	"PoopConf.start":         "Start of the time range, defaults to the beginning of the previous month.",
+	"PoopConf.end":           "End of the time range, defaults to the beginning of the current month.",
+	"PoopConf.group_by":      "Tags to group the data by, each tag is written as column.",
+	"PoopConf.format":        "Go time layout used to format timestamps.",
+	"PoopConf.separator":     "Separator of the columns in CSV, may consist of several characters.",
+	"PoopConf.replace_nil":   "Written instead of missing values in CSV and TSV.",
+	"PoopConf.precision":     "Number of decimals per field, '*' applies to all fields not listed.",
+	"PoopConf.number_format": "Number format per field: 'f' (decimal), 'e' (exponent) or 'g' (shortest), '*' applies to all fields not listed.",
+}
+
+// schemaEnums lists the values allowed for keys, written like the keys of
+// schemaDescriptions.
+var schemaEnums = map[string][]interface{}{
+	"RegurgitateConf.proto":  {"http", "https"},
+	"RegurgitateConf.paging": {PagingNone, PagingSearchAfter, PagingScroll},
+	"RuminateConf.root":      {RootAggregations, RootResponse},
+	"Iterator.lang":          {LangJee, LangJMESPath, LangJSONPath},
+	"GulpConf.proto":         {"http", "https"},
+}
+
+// schemaNoDefault lists keys whose default is computed at runtime.
+var schemaNoDefault = map[string]bool{
+	"PoopConf.start": true,
+	"PoopConf.end":   true,
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ConfigSchema generates a JSON Schema of the configuration file.
+func ConfigSchema() (*Schema, error) {
+	g := &schemaGen{
+		definitions: map[string]*Schema{},
+		used:        map[string]bool{},
+	}
+	s, err := g.object(reflect.ValueOf(DefaultConf()))
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for key := range schemaDescriptions {
+		if !g.used[key] {
+			stale = append(stale, key)
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		return nil, fmt.Errorf("schema describes unknown keys: %s", strings.Join(stale, ", "))
+	}
+
+	s.Schema = schemaDraft
+	s.Title = "ruminant configuration"
+	s.Definitions = g.definitions
+	return s, nil
+}
+
+type schemaGen struct {
+	definitions map[string]*Schema
+	used        map[string]bool
+}
+
+// object describes a struct, 'v' holds the default values of its fields.
+func (g *schemaGen) object(v reflect.Value) (*Schema, error) {
+	t := v.Type()
+	s := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := t.Name() + "." + name
+		desc, ok := schemaDescriptions[key]
+		if !ok {
+			return nil, fmt.Errorf("schema has no description for '%s'", key)
+		}
+		g.used[key] = true
+
+		prop, err := g.field(f.Type, v.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		if prop.Ref != "" {
+			// keywords next to '$ref' are ignored in draft-07, the reference
+			// is wrapped to keep the description
+			prop = &Schema{AllOf: []*Schema{prop}}
+		}
+		prop.Description = desc
+		prop.Enum = schemaEnums[key]
+		if fv := v.Field(i); !schemaNoDefault[key] && prop.AllOf == nil && fv.Kind() != reflect.Struct && !isZero(fv) {
+			prop.Default = fv.Interface()
+			if f.Type == durationType {
+				prop.Default = time.Duration(fv.Int()).String()
+			}
+		}
+		s.Properties[name] = prop
+	}
+	return s, nil
+}
+
+func (g *schemaGen) field(t reflect.Type, v reflect.Value) (*Schema, error) {
+	if t == durationType {
+		return &Schema{Type: []string{"string", "integer"}, Pattern: durationPattern}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.Map:
+		elem, err := g.field(t.Elem(), reflect.Zero(t.Elem()))
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: elem}, nil
+	case reflect.Slice:
+		items, err := g.field(t.Elem(), reflect.Zero(t.Elem()))
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Struct:
+		// structs that contain themselves such as the iterator are described
+		// once in the definitions and referenced
+		if t == reflect.TypeOf(Iterator{}) {
+			if _, ok := g.definitions[t.Name()]; !ok {
+				g.definitions[t.Name()] = &Schema{}
+				def, err := g.object(reflect.Zero(t))
+				if err != nil {
+					return nil, err
+				}
+				g.definitions[t.Name()] = def
+			}
+			return &Schema{Ref: "#/definitions/" + t.Name()}, nil
+		}
+		return g.object(v)
+	}
+	return nil, fmt.Errorf("type %s can not be described in the schema", t)
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
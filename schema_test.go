@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// walkSchema calls 'fn' for every property of the schema. References to
+// definitions are followed once, as definitions may refer to themselves.
+func walkSchema(root, s *Schema, path string, seen map[string]bool, fn func(path string, s *Schema)) {
+	if s.Ref != "" {
+		if seen[s.Ref] {
+			return
+		}
+		seen[s.Ref] = true
+		s = root.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	for _, sub := range s.AllOf {
+		walkSchema(root, sub, path, seen, fn)
+	}
+	for name, prop := range s.Properties {
+		p := name
+		if path != "" {
+			p = path + "." + name
+		}
+		fn(p, prop)
+		walkSchema(root, prop, p, seen, fn)
+	}
+	if s.Items != nil {
+		walkSchema(root, s.Items, path+"[]", seen, fn)
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	s, err := ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make(map[string]bool)
+	walkSchema(s, s, "", map[string]bool{}, func(path string, prop *Schema) {
+		paths[path] = true
+		if strings.TrimSpace(prop.Description) == "" {
+			t.Errorf("%s has no description", path)
+		}
+	})
+	for _, k := range ConfigKeys() {
+		if !paths[k.Path] {
+			t.Errorf("%s is missing in the schema", k.Path)
+		}
+	}
+	if _, err := json.Marshal(s); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigSchemaMissingDescription(t *testing.T) {
+	const key = "GulpConf.host"
+	desc := schemaDescriptions[key]
+	delete(schemaDescriptions, key)
+	defer func() { schemaDescriptions[key] = desc }()
+
+	_, err := ConfigSchema()
+	if err == nil || err.Error() != "schema has no description for 'GulpConf.host'" {
+		t.Errorf("expected an error for the missing description, got %v", err)
+	}
+}
+
+func TestConfigSchemaStaleDescription(t *testing.T) {
+	const key = "GulpConf.hots"
+	schemaDescriptions[key] = "Typo."
+	defer delete(schemaDescriptions, key)
+
+	_, err := ConfigSchema()
+	if err == nil || err.Error() != "schema describes unknown keys: GulpConf.hots" {
+		t.Errorf("expected an error for the stale description, got %v", err)
+	}
+}
+
+// refSiblings returns the paths of objects in the JSON document that have
+// keywords next to '$ref', which draft-07 ignores.
+func refSiblings(v interface{}, path string) []string {
+	var paths []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if _, ok := v["$ref"]; ok && len(v) > 1 {
+			paths = append(paths, path)
+		}
+		for k, sub := range v {
+			paths = append(paths, refSiblings(sub, path+"/"+k)...)
+		}
+	case []interface{}:
+		for n, sub := range v {
+			paths = append(paths, refSiblings(sub, fmt.Sprintf("%s/%d", path, n))...)
+		}
+	}
+	return paths
+}
+
+func TestConfigSchemaReferences(t *testing.T) {
+	s, err := ConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if paths := refSiblings(doc, ""); len(paths) > 0 {
+		t.Errorf("keywords next to $ref are ignored: %v", paths)
+	}
+
+	iterator := s.Properties["ruminate"].Properties["iterator"]
+	if iterator.Description == "" || len(iterator.AllOf) != 1 || iterator.AllOf[0].Ref != "#/definitions/Iterator" {
+		t.Errorf("expected the iterator to reference its definition along with a description, got %+v", iterator)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+)
+
+// Slice is a part of the time range processed by a single run. The slices
+// of a run are processed in order, once all queries of a slice are processed
+// its points are persisted and the marker is advanced to the slice.
+type Slice struct {
+	// At is the timestamp used for points that do not read their time from
+	// the response.
+	At      time.Time
+	From    time.Time
+	To      time.Time
+	Queries []Query
+	// Marker is the marker timestamp to be written once the slice is done.
+	// If zero, the timestamp of the newest point of the slice is used.
+	Marker time.Time
+}
+
+// BuildSlice returns a single slice starting at 'start' until 'end'. Since
+// the data processed is not bound to the slice, the marker is set to the
+// newest point found.
+func BuildSlice(qt QueryTemplate, start, end time.Time) ([]Slice, error) {
+	qc := qt.Context()
+	qc.Timestamp, qc.From, qc.To = start, start, end
+	query, err := qt.Render(qc)
+	if err != nil {
+		return nil, err
+	}
+	return []Slice{{
+		At:      start,
+		From:    start,
+		To:      end,
+		Queries: []Query{query},
+	}}, nil
+}
+
+// BuildChunks splits the time range from 'start' to 'end' into slices of the
+// duration given. Each slice is queried separately. Only complete chunks are
+// built, the remainder is left for the next run.
+func BuildChunks(qt QueryTemplate, start, end time.Time, chunk time.Duration) ([]Slice, error) {
+	var out []Slice
+	for from, to := start, start.Add(chunk); !to.After(end); from, to = to, to.Add(chunk) {
+		qc := qt.Context()
+		qc.Timestamp, qc.From, qc.To = from, from, to
+		qc.Interval = chunk.String()
+		query, err := qt.Render(qc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Slice{
+			At:      from,
+			From:    from,
+			To:      to,
+			Queries: []Query{query},
+			Marker:  to,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func testQueryTemplate(t *testing.T, query string) QueryTemplate {
+	c := DefaultConf()
+	c.Regurgitate.Index = "logstash-{yyyy.MM.dd}"
+	c.Regurgitate.Query = query
+	qt, err := NewQueryTemplate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return qt
+}
+
+func TestBuildSlice(t *testing.T) {
+	qt := testQueryTemplate(t, `{{ .FromMs }}-{{ .ToMs }}`)
+	start := time.Date(2020, 9, 1, 22, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 9, 2, 1, 0, 0, 0, time.UTC)
+	slices, err := BuildSlice(qt, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slices) != 1 {
+		t.Fatalf("expected a single slice, got %d", len(slices))
+	}
+	s := slices[0]
+	if !s.Marker.IsZero() {
+		t.Errorf("marker should be taken from the newest point, got %s", s.Marker)
+	}
+	if len(s.Queries) != 1 || s.Queries[0].Body != "1598997600000-1599008400000" {
+		t.Errorf("unexpected queries %v", s.Queries)
+	}
+	if s.Queries[0].Index != "logstash-2020.09.01,logstash-2020.09.02" {
+		t.Errorf("unexpected indices %s", s.Queries[0].Index)
+	}
+}
+
+func TestBuildChunks(t *testing.T) {
+	qt := testQueryTemplate(t, `{{ .FromMs }}`)
+	start := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		end    time.Time
+		chunks int
+	}{
+		{start, 0},
+		{start.Add(59 * time.Minute), 0},
+		{start.Add(time.Hour), 1},
+		{start.Add(150 * time.Minute), 2},
+	}
+	for _, test := range tests {
+		slices, err := BuildChunks(qt, start, test.end, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(slices) != test.chunks {
+			t.Errorf("%s: expected %d chunks, got %d", test.end.Sub(start), test.chunks, len(slices))
+			continue
+		}
+		for n, s := range slices {
+			from := start.Add(time.Duration(n) * time.Hour)
+			if !s.From.Equal(from) || !s.To.Equal(from.Add(time.Hour)) || !s.Marker.Equal(s.To) {
+				t.Errorf("chunk %d: unexpected range %s - %s, marker %s", n, s.From, s.To, s.Marker)
+			}
+		}
+	}
+}
+
+func TestSamplerBuildSlices(t *testing.T) {
+	qt := testQueryTemplate(t, `{{ . }}`)
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Hour)
+	tests := []struct {
+		samples int
+		offsets []time.Duration
+	}{
+		{1, []time.Duration{0}},
+		{2, []time.Duration{5 * time.Minute, -5 * time.Minute}},
+		{3, []time.Duration{0, 10 * time.Minute, -10 * time.Minute}},
+		{4, []time.Duration{5 * time.Minute, -5 * time.Minute, 15 * time.Minute, -15 * time.Minute}},
+	}
+	for _, test := range tests {
+		s, err := NewSampler(SamplerConfig{
+			Interval:     "0 0 * * * *",
+			Samples:      test.samples,
+			SampleOffset: 10 * time.Minute,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices, err := s.BuildSlices(qt, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(slices) < 2 {
+			t.Fatalf("expected at least two intervals, got %d", len(slices))
+		}
+		for n, slice := range slices {
+			if !slice.Marker.Equal(slice.At) || slice.At.Sub(slice.From) != time.Hour {
+				t.Errorf("slice %d: unexpected range %s - %s, marker %s", n, slice.From, slice.At, slice.Marker)
+			}
+			if len(slice.Queries) != len(test.offsets) {
+				t.Fatalf("%d samples: expected %d queries, got %d", test.samples, len(test.offsets), len(slice.Queries))
+			}
+			for i, offset := range test.offsets {
+				expected := slice.At.Add(offset)
+				if slice.Queries[i].Body != (QueryContext{Timestamp: expected}).String() {
+					t.Errorf("%d samples: query %d expected at %s, got %s", test.samples, i, expected, slice.Queries[i].Body)
+				}
+			}
+		}
+	}
+}
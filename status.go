@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Exit codes of Nagios plugins.
+const (
+	NagiosOK       = 0
+	NagiosWarning  = 1
+	NagiosCritical = 2
+	NagiosUnknown  = 3
+)
+
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// DefaultStatusTimeout limits the time waited for each check of a
+// configuration, unless another timeout is passed.
+const DefaultStatusTimeout = 5 * time.Second
+
+// timeoutError is returned by checks that did not complete in time.
+type timeoutError time.Duration
+
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("no response within %s", time.Duration(e))
+}
+
+// withTimeout runs the check and gives up after the timeout. A check given up
+// on keeps running in the background, its result is discarded.
+func withTimeout(timeout time.Duration, check func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check()
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-t.C:
+		return timeoutError(timeout)
+	}
+}
+
+// Status describes how far a configuration is behind.
+type Status struct {
+	Name string
+	// Err is set if the configuration could not be read.
+	Err     error
+	Marker  time.Time
+	Lag     time.Duration
+	Pending int
+	// Elastic and Influx hold the error if the database is not reachable.
+	Elastic     error
+	ElasticInfo string
+	Influx      error
+	MarkerErr   error
+}
+
+// GetStatus checks the databases and the marker of a configuration. The lag
+// is the time from the marker to the end of the time range the next run
+// would process, ie. now minus the sampler offset. Each check gives up after
+// the timeout, a marker query timing out counts as InfluxDB not reachable.
+func GetStatus(cfgFile string, c Config, now time.Time, timeout time.Duration) Status {
+	s := Status{Name: c.Gulp.Indicator}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(cfgFile), filepath.Ext(cfgFile))
+	}
+
+	esTimeout := c.Regurgitate.Timeout
+	if esTimeout <= 0 || esTimeout > timeout {
+		esTimeout = timeout
+	}
+	es := NewElasticSearchTimeout(c.Regurgitate.NodeUrls(), esTimeout)
+	var info EsInfo
+	if err := withTimeout(timeout, func() (err error) {
+		info, err = es.Detect()
+		return err
+	}); err != nil {
+		s.Elastic = err
+	} else {
+		s.ElasticInfo = info.String()
+	}
+
+	i, err := NewInflux(c.Gulp.Host, c.Gulp.Proto, c.Gulp.Db, c.Gulp.RetentionPolicy.Name, c.Gulp.User, c.Gulp.Pass, c.Gulp.Series, c.Gulp.Indicator, c.Gulp.Port)
+	if err != nil {
+		s.Influx = err
+		return s
+	}
+	if err := withTimeout(timeout, func() error {
+		_, _, err := i.Client.Ping(timeout)
+		return err
+	}); err != nil {
+		s.Influx = err
+		return s
+	}
+	var m Marker
+	if err := withTimeout(timeout, func() (err error) {
+		m, err = i.GetMarker()
+		return err
+	}); err != nil {
+		if _, ok := err.(timeoutError); ok {
+			s.Influx = err
+		} else {
+			s.MarkerErr = err
+		}
+		return s
+	}
+	s.Marker = m.Time
+
+	end := now.Add(-c.Regurgitate.Sampler.Offset)
+	if end.After(s.Marker) {
+		s.Lag = end.Sub(s.Marker).Truncate(time.Second)
+	}
+	switch {
+	case c.Regurgitate.Sampler.Interval != "":
+		sampler, err := NewSampler(c.Regurgitate.Sampler)
+		if err != nil {
+			s.Err = err
+			return s
+		}
+		s.Pending = len(sampler.Iterate(s.Marker))
+	case c.Regurgitate.Chunk > 0:
+		s.Pending = int(s.Lag / c.Regurgitate.Chunk)
+	case s.Lag > 0:
+		s.Pending = 1
+	}
+	return s
+}
+
+// Check returns the Nagios state of the configuration along with a message
+// describing the problem. Lags exceeding 'warn' or 'max' are reported as
+// warning or critical, thresholds that are zero are not checked.
+func (s Status) Check(warn, max time.Duration) (int, string) {
+	switch {
+	case s.Err != nil:
+		return NagiosUnknown, fmt.Sprintf("%s: %s", s.Name, s.Err.Error())
+	case s.Influx != nil:
+		return NagiosCritical, fmt.Sprintf("%s: InfluxDB not reachable", s.Name)
+	case s.Elastic != nil:
+		return NagiosCritical, fmt.Sprintf("%s: ElasticSearch not reachable", s.Name)
+	case s.MarkerErr != nil:
+		return NagiosUnknown, fmt.Sprintf("%s: no marker found", s.Name)
+	case max > 0 && s.Lag > max:
+		return NagiosCritical, fmt.Sprintf("%s: lag %s exceeds %s", s.Name, s.Lag, max)
+	case warn > 0 && s.Lag > warn:
+		return NagiosWarning, fmt.Sprintf("%s: lag %s exceeds %s", s.Name, s.Lag, warn)
+	}
+	return NagiosOK, fmt.Sprintf("%s: lag %s", s.Name, s.Lag)
+}
+
+// Perfdata returns the performance data of the configuration as understood
+// by Nagios.
+func (s Status) Perfdata(warn, max time.Duration) string {
+	threshold := func(d time.Duration) string {
+		if d <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("%d", int64(d.Seconds()))
+	}
+	up := func(err error) int {
+		if err != nil {
+			return 0
+		}
+		return 1
+	}
+	label := strings.Replace(s.Name, "'", "''", -1)
+	perf := []string{
+		fmt.Sprintf("'%s_elasticsearch'=%d;;;0;1", label, up(s.Elastic)),
+		fmt.Sprintf("'%s_influxdb'=%d;;;0;1", label, up(s.Influx)),
+	}
+	if !s.Marker.IsZero() {
+		perf = append(perf,
+			fmt.Sprintf("'%s_lag'=%ds;%s;%s;0", label, int64(s.Lag.Seconds()), threshold(warn), threshold(max)),
+			fmt.Sprintf("'%s_pending'=%d;;;0", label, s.Pending),
+		)
+	}
+	return strings.Join(perf, " ")
+}
+
+// String describes the status in detail.
+func (s Status) String() string {
+	if s.Err != nil {
+		return fmt.Sprintf("%s: %s", s.Name, s.Err.Error())
+	}
+	var parts []string
+	if s.Elastic != nil {
+		parts = append(parts, "elasticsearch: "+s.Elastic.Error())
+	} else {
+		parts = append(parts, s.ElasticInfo+" reachable")
+	}
+	if s.Influx != nil {
+		parts = append(parts, "influxdb: "+s.Influx.Error())
+	} else {
+		parts = append(parts, "InfluxDB reachable")
+	}
+	switch {
+	case s.MarkerErr != nil:
+		parts = append(parts, "marker: "+s.MarkerErr.Error())
+	case !s.Marker.IsZero():
+		parts = append(parts,
+			"marker: "+s.Marker.UTC().Format(time.RFC3339),
+			"lag: "+s.Lag.String(),
+			fmt.Sprintf("pending: %d", s.Pending),
+		)
+	}
+	return s.Name + ": " + strings.Join(parts, ", ")
+}
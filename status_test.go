@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	failed := errors.New("failed")
+	release := make(chan struct{})
+	defer close(release)
+	tests := []struct {
+		name     string
+		check    func() error
+		expected error
+	}{
+		{name: "ok", check: func() error { return nil }},
+		{name: "error", check: func() error { return failed }, expected: failed},
+		{name: "timeout", check: func() error {
+			<-release
+			return nil
+		}, expected: timeoutError(20 * time.Millisecond)},
+	}
+	for _, test := range tests {
+		if err := withTimeout(20*time.Millisecond, test.check); err != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+	if msg := timeoutError(5 * time.Second).Error(); msg != "no response within 5s" {
+		t.Errorf("unexpected message %s", msg)
+	}
+}
+
+func TestStatusCheck(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name   string
+		status Status
+		state  int
+		msg    string
+	}{
+		{name: "ok", status: Status{Name: "www", Lag: 30 * time.Minute}, state: NagiosOK, msg: "www: lag 30m0s"},
+		{name: "warning", status: Status{Name: "www", Lag: 90 * time.Minute}, state: NagiosWarning, msg: "www: lag 1h30m0s exceeds 1h0m0s"},
+		{name: "critical", status: Status{Name: "www", Lag: 3 * time.Hour}, state: NagiosCritical, msg: "www: lag 3h0m0s exceeds 2h0m0s"},
+		{name: "config", status: Status{Name: "www.yaml", Err: failed}, state: NagiosUnknown, msg: "www.yaml: failed"},
+		{name: "influx", status: Status{Name: "www", Influx: timeoutError(time.Second), Elastic: failed}, state: NagiosCritical, msg: "www: InfluxDB not reachable"},
+		{name: "elastic", status: Status{Name: "www", Elastic: failed}, state: NagiosCritical, msg: "www: ElasticSearch not reachable"},
+		{name: "marker", status: Status{Name: "www", MarkerErr: failed}, state: NagiosUnknown, msg: "www: no marker found"},
+	}
+	for _, test := range tests {
+		state, msg := test.status.Check(time.Hour, 2*time.Hour)
+		if state != test.state || msg != test.msg {
+			t.Errorf("%s: expected %d %q, got %d %q", test.name, test.state, test.msg, state, msg)
+		}
+	}
+
+	if state, _ := (Status{Name: "www", Lag: 100 * time.Hour}).Check(0, 0); state != NagiosOK {
+		t.Errorf("expected thresholds of zero not to be checked, got state %d", state)
+	}
+}
+
+func TestStatusPerfdata(t *testing.T) {
+	marker := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		status    Status
+		warn, max time.Duration
+		expected  string
+	}{
+		{
+			name:     "lag",
+			status:   Status{Name: "www", Marker: marker, Lag: 2 * time.Hour, Pending: 8},
+			warn:     time.Hour,
+			max:      3 * time.Hour,
+			expected: "'www_elasticsearch'=1;;;0;1 'www_influxdb'=1;;;0;1 'www_lag'=7200s;3600;10800;0 'www_pending'=8;;;0",
+		},
+		{
+			name:     "no thresholds",
+			status:   Status{Name: "www", Marker: marker, Lag: time.Minute},
+			expected: "'www_elasticsearch'=1;;;0;1 'www_influxdb'=1;;;0;1 'www_lag'=60s;;;0 'www_pending'=0;;;0",
+		},
+		{
+			name:     "unreachable",
+			status:   Status{Name: "it's", Elastic: errors.New("failed"), Influx: timeoutError(time.Second)},
+			expected: "'it''s_elasticsearch'=0;;;0;1 'it''s_influxdb'=0;;;0;1",
+		},
+	}
+	for _, test := range tests {
+		if perf := test.status.Perfdata(test.warn, test.max); perf != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name, test.expected, perf)
+		}
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   Status
+		expected string
+	}{
+		{
+			name:     "ok",
+			status:   Status{Name: "www", ElasticInfo: "ElasticSearch 7.10.0", Marker: time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC), Lag: time.Hour, Pending: 4},
+			expected: "www: ElasticSearch 7.10.0 reachable, InfluxDB reachable, marker: 2020-09-01T10:00:00Z, lag: 1h0m0s, pending: 4",
+		},
+		{
+			name:     "unreachable",
+			status:   Status{Name: "www", Elastic: errors.New("refused"), Influx: timeoutError(5 * time.Second)},
+			expected: "www: elasticsearch: refused, influxdb: no response within 5s",
+		},
+		{
+			name:     "marker",
+			status:   Status{Name: "www", ElasticInfo: "OpenSearch 1.0.0", MarkerErr: errors.New("no marker found for indicator 'www'")},
+			expected: "www: OpenSearch 1.0.0 reachable, InfluxDB reachable, marker: no marker found for indicator 'www'",
+		},
+		{
+			name:     "config",
+			status:   Status{Name: "www.yaml", Err: errors.New("invalid")},
+			expected: "www.yaml: invalid",
+		},
+	}
+	for _, test := range tests {
+		if s := test.status.String(); s != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name, test.expected, s)
+		}
+	}
+}
+
+// statusServer answers ElasticSearch and InfluxDB requests. Requests to the
+// paths in 'hang' are only answered once 'release' is closed.
+func statusServer(hang map[string]bool, release chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang[r.URL.Path] {
+			<-release
+		}
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`{"version": {"number": "7.10.0"}}`))
+		case "/ping":
+			w.WriteHeader(http.StatusNoContent)
+		case "/query":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(markerResult))
+		}
+	}))
+}
+
+func TestGetStatus(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		hang     map[string]bool
+		expected string
+	}{
+		{
+			name:     "ok",
+			expected: "ind: ElasticSearch 7.10.0 reachable, InfluxDB reachable, marker: 2020-09-01T10:00:00Z, lag: 2h0m0s, pending: 1",
+		},
+		{
+			name:     "elasticsearch",
+			hang:     map[string]bool{"/": true},
+			expected: "ind: elasticsearch: no response within 100ms, InfluxDB reachable, marker: 2020-09-01T10:00:00Z, lag: 2h0m0s, pending: 1",
+		},
+		{
+			name:     "ping",
+			hang:     map[string]bool{"/ping": true},
+			expected: "ind: ElasticSearch 7.10.0 reachable, influxdb: no response within 100ms",
+		},
+		{
+			name:     "marker",
+			hang:     map[string]bool{"/query": true},
+			expected: "ind: ElasticSearch 7.10.0 reachable, influxdb: no response within 100ms",
+		},
+	}
+	for _, test := range tests {
+		release := make(chan struct{})
+		srv := statusServer(test.hang, release)
+		u, err := url.Parse(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		port, err := strconv.Atoi(u.Port())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := DefaultConf()
+		c.Regurgitate.Nodes = []string{srv.URL}
+		c.Gulp.Host = u.Hostname()
+		c.Gulp.Port = port
+		c.Gulp.Db = "db"
+		c.Gulp.Series = "s"
+		c.Gulp.Indicator = "ind"
+
+		start := time.Now()
+		s := GetStatus("ind.yaml", c, now, 100*time.Millisecond)
+		took := time.Since(start)
+		close(release)
+		srv.Close()
+
+		if s.String() != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name, test.expected, s.String())
+		}
+		if took > time.Second {
+			t.Errorf("%s: expected the checks to give up in time, took %s", test.name, took)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// QueryContext is passed to the query template. Used as '{{ . }}' it renders
+// as its timestamp in milliseconds.
+type QueryContext struct {
+	// Timestamp is the point in time the query is executed for. This is the
+	// start of the time window or, if a sampler is configured, the time of
+	// the sample.
+	Timestamp time.Time
+	// From and To describe the time window queried.
+	From time.Time
+	To   time.Time
+	// SampleOffset is the offset of the sample to the interval of the sampler.
+	SampleOffset time.Duration
+	// Interval is the sampler interval or the chunk duration, if configured.
+	Interval string
+	// Now is the time the run has started.
+	Now time.Time
+	// Name is the name of the pipeline.
+	Name string
+	// Vars holds the variables configured in 'regurgitate.vars'.
+	Vars map[string]string
+}
+
+func (qc QueryContext) String() string {
+	return strconv.FormatInt(ToEsTimestamp(qc.Timestamp), 10)
+}
+
+// FromMs returns the start of the time window in milliseconds.
+func (qc QueryContext) FromMs() int64 {
+	return ToEsTimestamp(qc.From)
+}
+
+// ToMs returns the end of the time window in milliseconds.
+func (qc QueryContext) ToMs() int64 {
+	return ToEsTimestamp(qc.To)
+}
+
+var queryFuncs = template.FuncMap{
+	"formatTime": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"epoch": func(t time.Time) int64 {
+		return t.Unix()
+	},
+	"epochMs": ToEsTimestamp,
+	"iso8601": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02T15:04:05.000Z")
+	},
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"jsonEscape": func(s string) (string, error) {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(strings.TrimPrefix(string(b), "\""), "\""), nil
+	},
+	"env": func(key string) (string, error) {
+		v, ok := os.LookupEnv(key)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", key)
+		}
+		return v, nil
+	},
+}
+
+// Query is a rendered query along with the indices it is executed on.
+type Query struct {
+	Index string
+	Body  string
+}
+
+// QueryTemplate renders the query configured for a given query context.
+type QueryTemplate struct {
+	t     *template.Template
+	index IndexPattern
+	base  QueryContext
+}
+
+func NewQueryTemplate(c Config) (QueryTemplate, error) {
+	qt := QueryTemplate{
+		base: QueryContext{
+			Now:  time.Now(),
+			Name: c.PipelineName(),
+			Vars: c.Regurgitate.Vars,
+		},
+	}
+	t, err := template.New("query").Funcs(queryFuncs).Option("missingkey=error").Parse(c.Regurgitate.Query)
+	if err != nil {
+		return qt, fmt.Errorf("could not parse query template: %s", err.Error())
+	}
+	qt.t = t
+
+	index, err := NewIndexPattern(c.Regurgitate.Index, c.Regurgitate.Timezone)
+	if err != nil {
+		return qt, err
+	}
+	qt.index = index
+	return qt, nil
+}
+
+// DynamicIndex indicates whether the indices queried depend on the time
+// window of the query.
+func (qt QueryTemplate) DynamicIndex() bool {
+	return qt.index.Dynamic()
+}
+
+// Context returns a query context prefilled with the values that are the same
+// for all queries of a run.
+func (qt QueryTemplate) Context() QueryContext {
+	return qt.base
+}
+
+// Render renders the query for the context given. The indices are expanded
+// to cover the time window of the context.
+func (qt QueryTemplate) Render(qc QueryContext) (Query, error) {
+	var body bytes.Buffer
+	if err := qt.t.Execute(&body, qc); err != nil {
+		return Query{}, fmt.Errorf("could not render query template: %s", err.Error())
+	}
+	return Query{
+		Index: qt.index.Expand(qc.From, qc.To),
+		Body:  body.String(),
+	}, nil
+}
+
+// RenderSample renders the query for the hour before the end of a run. This
+// is used to inspect the query without knowing the latest marker timestamp.
+func (qt QueryTemplate) RenderSample(s SamplerConfig) (Query, error) {
+	qc := qt.Context()
+	qc.To = qc.Now.Add(-s.Offset)
+	qc.From = qc.To.Add(-time.Hour)
+	qc.Timestamp = qc.From
+	qc.Interval = s.Interval
+	return qt.Render(qc)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryTemplateRender(t *testing.T) {
+	os.Setenv("RUMINANT_TEST_TEMPLATE", "from env")
+	defer os.Unsetenv("RUMINANT_TEST_TEMPLATE")
+
+	from := time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	qc := QueryContext{
+		Timestamp:    from,
+		From:         from,
+		To:           to,
+		SampleOffset: 5 * time.Minute,
+		Interval:     "1h0m0s",
+		Name:         "www",
+		Vars:         map[string]string{"field": "bytes"},
+	}
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{`{{ . }}`, "1598954400000"},
+		{`{{ .FromMs }} {{ .ToMs }}`, "1598954400000 1598958000000"},
+		{`{{ epoch .To }} {{ epochMs .To }}`, "1598958000 1598958000000"},
+		{`{{ iso8601 .From }}`, "2020-09-01T10:00:00.000Z"},
+		{`{{ formatTime "2006-01-02" .From }}`, "2020-09-01"},
+		{`{{ .Vars.field }} {{ .Name }} {{ .Interval }} {{ .SampleOffset }}`, "bytes www 1h0m0s 5m0s"},
+		{`{{ json .Vars }}`, `{"field":"bytes"}`},
+		{`"{{ jsonEscape "a \"quoted\"\n" }}"`, `"a \"quoted\"\n"`},
+		{`{{ env "RUMINANT_TEST_TEMPLATE" }}`, "from env"},
+	}
+	for _, test := range tests {
+		c := DefaultConf()
+		c.Regurgitate.Query = test.query
+		qt, err := NewQueryTemplate(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := qt.Render(qc)
+		if err != nil {
+			t.Errorf("%s: %s", test.query, err.Error())
+			continue
+		}
+		if q.Body != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.query, test.expected, q.Body)
+		}
+		if q.Index != "logstash-*" {
+			t.Errorf("%s: unexpected index %s", test.query, q.Index)
+		}
+	}
+}
+
+func TestQueryTemplateErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{`{{ .From `, "could not parse query template"},
+		{`{{ .Vars.missing }}`, "could not render query template"},
+		{`{{ env "RUMINANT_TEST_UNSET" }}`, "RUMINANT_TEST_UNSET is not set"},
+	}
+	for _, test := range tests {
+		c := DefaultConf()
+		c.Regurgitate.Query = test.query
+		c.Regurgitate.Vars = map[string]string{}
+		qt, err := NewQueryTemplate(c)
+		if err == nil {
+			_, err = qt.Render(qt.Context())
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error '%s', got %v", test.query, test.err, err)
+		}
+	}
+}
+
+func TestQueryTemplateRenderSample(t *testing.T) {
+	c := DefaultConf()
+	c.Regurgitate.Query = `{{ .Interval }}`
+	qt, err := NewQueryTemplate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := qt.RenderSample(SamplerConfig{Interval: "@hourly", Offset: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Body != "@hourly" {
+		t.Errorf("unexpected query %s", q.Body)
+	}
+}
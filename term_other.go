@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "fmt"
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (interface{}, error) {
+	return nil, fmt.Errorf("raw mode is not supported on this platform")
+}
+
+func restoreTerm(fd int, state interface{}) error {
+	return nil
+}
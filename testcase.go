@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Files a test case directory consists of. Either a full config or only an
+// iterator is read, the expected points are read from YAML or line protocol.
+const (
+	caseResponse     = "response.json"
+	caseConfig       = "config.yaml"
+	caseIterator     = "iterator.yaml"
+	caseExpectedYaml = "expected.yaml"
+	caseExpectedLp   = "expected.lp"
+)
+
+// caseSeries is used as measurement in line protocol if no config is given.
+const caseSeries = "ruminant"
+
+// TestCase runs an iterator against a captured ElasticSearch response and
+// compares the resulting points to the points expected.
+type TestCase struct {
+	Name     string
+	Dir      string
+	Series   string
+	Root     string
+	Iterator Iterator
+	Response []byte
+}
+
+// FindTestCases loads all test cases found in 'dir'. If 'dir' contains a
+// response itself, it is a single test case, otherwise every subdirectory
+// containing a response is.
+func FindTestCases(dir string) ([]TestCase, error) {
+	if _, err := os.Stat(filepath.Join(dir, caseResponse)); err == nil {
+		tc, err := LoadTestCase(dir)
+		return []TestCase{tc}, err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var cases []TestCase
+	for _, e := range entries {
+		sub := filepath.Join(dir, e.Name())
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(sub, caseResponse)); err != nil {
+			continue
+		}
+		tc, err := LoadTestCase(sub)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, tc)
+	}
+	if len(cases) < 1 {
+		return nil, fmt.Errorf("no test cases found in %s", dir)
+	}
+	sort.Slice(cases, func(a, b int) bool { return cases[a].Name < cases[b].Name })
+	return cases, nil
+}
+
+// LoadTestCase reads the test case in 'dir'.
+func LoadTestCase(dir string) (TestCase, error) {
+	tc := TestCase{
+		Name:   filepath.Base(filepath.Clean(dir)),
+		Dir:    dir,
+		Series: caseSeries,
+		Root:   RootAggregations,
+	}
+
+	var err error
+	tc.Response, err = ioutil.ReadFile(filepath.Join(dir, caseResponse))
+	if err != nil {
+		return tc, err
+	}
+
+	cfgFile := filepath.Join(dir, caseConfig)
+	iterFile := filepath.Join(dir, caseIterator)
+	if _, err := os.Stat(cfgFile); err == nil {
+		c, err := NewConf(cfgFile, true, nil)
+		if err != nil {
+			return tc, err
+		}
+		tc.Iterator = c.Ruminate.Iterator
+		tc.Root = c.Ruminate.Root
+		if c.Gulp.Series != "" {
+			tc.Series = c.Gulp.Series
+		}
+	} else if b, err := ioutil.ReadFile(iterFile); err == nil {
+		if err := yaml.UnmarshalStrict(b, &tc.Iterator); err != nil {
+			return tc, fmt.Errorf("error while parsing %s: %s", iterFile, err.Error())
+		}
+		if err := tc.Iterator.Compile(); err != nil {
+			return tc, fmt.Errorf("error in %s: %s", iterFile, err.Error())
+		}
+	} else {
+		return tc, fmt.Errorf("test case %s has neither %s nor %s", dir, caseConfig, caseIterator)
+	}
+	return tc, nil
+}
+
+// Run processes the response of the test case.
+func (tc TestCase) Run() ([]Point, error) {
+	r, err := NewEsResponse(bytes.NewReader(tc.Response))
+	if err != nil {
+		return nil, err
+	}
+	j, err := r.Root(tc.Root)
+	if err != nil {
+		return nil, err
+	}
+	p := Point{
+		Tags:   make(map[string]string),
+		Values: make(map[string]interface{}),
+	}
+	return Chew(j, tc.Iterator, p)
+}
+
+// expectedFile returns the file holding the expected points. If none exists
+// yet, the YAML file is returned.
+func (tc TestCase) expectedFile() string {
+	lp := filepath.Join(tc.Dir, caseExpectedLp)
+	if _, err := os.Stat(lp); err == nil {
+		return lp
+	}
+	return filepath.Join(tc.Dir, caseExpectedYaml)
+}
+
+// Expected reads the points expected.
+func (tc TestCase) Expected() ([]Point, error) {
+	file := tc.expectedFile()
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(file, ".lp") {
+		return ParseLineProtocol(b)
+	}
+	return ParsePointsYaml(b)
+}
+
+// Update replaces the points expected with the points given.
+func (tc TestCase) Update(points []Point) error {
+	file := tc.expectedFile()
+	var out []byte
+	if strings.HasSuffix(file, ".lp") {
+		for _, p := range points {
+			pt, err := p.InfluxPoint(tc.Series)
+			if err != nil {
+				return fmt.Errorf("point @ %s: %s", formatTime(p.Timestamp), err.Error())
+			}
+			out = append(out, pt.String()+"\n"...)
+		}
+	} else {
+		var err error
+		if out, err = PointsYaml(points); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(file, out, 0644)
+}
+
+// Compare returns a diff of the points expected and the actual points. An
+// empty string is returned if they are equal.
+func (tc TestCase) Compare(expected, actual []Point) string {
+	var exp, act []string
+	for _, p := range expected {
+		exp = append(exp, tc.line(p))
+	}
+	for _, p := range actual {
+		act = append(act, tc.line(p))
+	}
+	return Diff(exp, act)
+}
+
+// line formats a point for comparison. Points that can not be written are
+// shown along with the reason, so they show up in the diff.
+func (tc TestCase) line(p Point) string {
+	pt, err := p.InfluxPoint(tc.Series)
+	if err != nil {
+		return fmt.Sprintf("# %s: %s", p, err.Error())
+	}
+	return pt.String()
+}
+
+// pointDoc is the representation of a point in YAML and JSON files.
+type pointDoc struct {
+	Time   string                 `yaml:"time,omitempty" json:"time,omitempty"`
+	Tags   map[string]string      `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Values map[string]interface{} `yaml:"values,omitempty" json:"values,omitempty"`
+}
+
+func newPointDoc(p Point) pointDoc {
+	return pointDoc{Time: formatTime(p.Timestamp), Tags: p.Tags, Values: p.Values}
+}
+
+// PointsYaml formats points as YAML list.
+func PointsYaml(points []Point) ([]byte, error) {
+	docs := []pointDoc{}
+	for _, p := range points {
+		docs = append(docs, newPointDoc(p))
+	}
+	return yaml.Marshal(docs)
+}
+
+// ParsePointsYaml reads points written by PointsYaml. Integers are read as
+// floats since this is how numbers in responses are processed.
+func ParsePointsYaml(in []byte) ([]Point, error) {
+	var docs []pointDoc
+	if err := yaml.UnmarshalStrict(in, &docs); err != nil {
+		return nil, err
+	}
+	var points []Point
+	for _, d := range docs {
+		p := Point{
+			Tags:   make(map[string]string),
+			Values: make(map[string]interface{}),
+		}
+		if d.Time != "" {
+			t, err := time.Parse(time.RFC3339Nano, d.Time)
+			if err != nil {
+				return nil, err
+			}
+			p.Timestamp = t
+		}
+		for key, value := range d.Tags {
+			p.Tags[key] = value
+		}
+		for key, value := range d.Values {
+			if i, ok := value.(int); ok {
+				value = float64(i)
+			}
+			p.Values[key] = value
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// maxDiffCells limits the size of the table used to compare lines.
+const maxDiffCells = 4 << 20
+
+// Diff compares two lists of lines and returns the lines removed prefixed with
+// '-' and the lines added prefixed with '+', along with two lines of context.
+// An empty string is returned if both lists are equal.
+func Diff(a, b []string) string {
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+
+	// lines that are equal at the beginning and the end are skipped before
+	// comparing the rest, which keeps the comparison of large lists cheap
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		lines = append(lines, line{' ', a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	changed := len(ma) > 0 || len(mb) > 0
+
+	if len(ma)*len(mb) > maxDiffCells {
+		// too large to find the longest common subsequence
+		for _, text := range ma {
+			lines = append(lines, line{'-', text})
+		}
+		for _, text := range mb {
+			lines = append(lines, line{'+', text})
+		}
+	} else {
+		// longest common subsequence
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				lines = append(lines, line{' ', ma[i]})
+				i++
+				j++
+			case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+				lines = append(lines, line{'-', ma[i]})
+				i++
+			default:
+				lines = append(lines, line{'+', mb[j]})
+				j++
+			}
+		}
+	}
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, line{' ', text})
+	}
+
+	if !changed {
+		return ""
+	}
+
+	const context = 2
+	var out strings.Builder
+	skipped := false
+	for n, l := range lines {
+		near := false
+		for k := n - context; k <= n+context; k++ {
+			if k >= 0 && k < len(lines) && lines[k].op != ' ' {
+				near = true
+				break
+			}
+		}
+		if !near {
+			skipped = true
+			continue
+		}
+		if skipped {
+			out.WriteString("  ...\n")
+			skipped = false
+		}
+		fmt.Fprintf(&out, "%c %s\n", l.op, l.text)
+	}
+	if skipped {
+		out.WriteString("  ...\n")
+	}
+	return out.String()
+}
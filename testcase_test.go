@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		diff string
+	}{
+		{"equal", []string{"a", "b"}, []string{"a", "b"}, ""},
+		{"empty", nil, nil, ""},
+		{"added", []string{"a"}, []string{"a", "b"}, "  a\n+ b\n"},
+		{"removed", []string{"a", "b"}, []string{"b"}, "- a\n  b\n"},
+		{"changed", []string{"a", "b", "c"}, []string{"a", "x", "c"}, "  a\n- b\n+ x\n  c\n"},
+		{"all new", nil, []string{"a"}, "+ a\n"},
+		{
+			"context",
+			[]string{"1", "2", "3", "4", "5", "6", "7", "8", "9"},
+			[]string{"1", "2", "3", "4", "x", "6", "7", "8", "9"},
+			"  ...\n  3\n  4\n- 5\n+ x\n  6\n  7\n  ...\n",
+		},
+		{
+			"subsequence",
+			[]string{"a", "b", "c", "d"},
+			[]string{"b", "c", "d", "e"},
+			"- a\n  b\n  c\n  d\n+ e\n",
+		},
+	}
+	for _, test := range tests {
+		if diff := Diff(test.a, test.b); diff != test.diff {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name, test.diff, diff)
+		}
+	}
+}
+
+func TestDiffLarge(t *testing.T) {
+	// too large to compare line by line, the lines differing are listed
+	// as removed and added
+	n := 3000
+	a := make([]string, n)
+	b := make([]string, n)
+	for i := range a {
+		a[i] = strings.Repeat("a", i%7)
+		b[i] = strings.Repeat("b", i%5)
+	}
+	removed, added := 0, 0
+	for _, line := range strings.Split(Diff(a, b), "\n") {
+		switch {
+		case strings.HasPrefix(line, "- "):
+			removed++
+		case strings.HasPrefix(line, "+ "):
+			added++
+		}
+	}
+	// the first lines are equal
+	if removed != n-1 || added != n-1 {
+		t.Errorf("expected %d lines removed and added, got %d and %d", n-1, removed, added)
+	}
+}
+
+func TestCompareUnwritable(t *testing.T) {
+	tc := TestCase{Series: "s"}
+	expected := []Point{{Values: map[string]interface{}{"v": 1.0}}}
+	actual := []Point{{Values: map[string]interface{}{"v": nil}}}
+	diff := tc.Compare(expected, actual)
+	if !strings.Contains(diff, "- s v=1\n") || !strings.Contains(diff, "point without fields is unsupported") {
+		t.Errorf("unexpected diff %s", diff)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts accepted for absolute times, times without zone are read in the
+// location passed to ParseTimeExpr.
+var absoluteLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// timeOffset matches a single offset of a relative time expression. Units
+// follow the conventions of Grafana: 'm' are minutes, 'M' are months.
+var timeOffset = regexp.MustCompile(`^([+-])(\d+)(ms|s|m|h|d|w|M|y)`)
+
+// ParseTimeExpr reads an absolute time such as '2020-09-01' or a relative
+// expression. Relative expressions start with 'now', 'today', 'yesterday',
+// 'startOfDay', 'startOfWeek', 'startOfMonth' or 'startOfYear', followed by
+// any number of offsets such as '-7d' or '+1h'. If only offsets are given,
+// they are relative to 'now', eg. '-7d'. Weeks start on monday.
+func ParseTimeExpr(expr string, now time.Time) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+	for _, layout := range absoluteLayouts {
+		if t, err := time.ParseInLocation(layout, expr, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	y, mon, d := now.Date()
+	day := time.Date(y, mon, d, 0, 0, 0, 0, now.Location())
+	anchors := []struct {
+		name string
+		t    time.Time
+	}{
+		{"now", now},
+		{"today", day},
+		{"yesterday", day.AddDate(0, 0, -1)},
+		{"startOfDay", day},
+		{"startOfWeek", day.AddDate(0, 0, -(int(day.Weekday())+6)%7)},
+		{"startOfMonth", time.Date(y, mon, 1, 0, 0, 0, 0, now.Location())},
+		{"startOfYear", time.Date(y, 1, 1, 0, 0, 0, 0, now.Location())},
+	}
+	t, rest := now, expr
+	for _, a := range anchors {
+		if strings.HasPrefix(expr, a.name) {
+			t, rest = a.t, strings.TrimPrefix(expr, a.name)
+			break
+		}
+	}
+	if rest == expr && !timeOffset.MatchString(rest) {
+		return time.Time{}, fmt.Errorf("'%s' is neither a date nor a relative time such as '-7d' or 'startOfWeek'", expr)
+	}
+
+	for rest != "" {
+		m := timeOffset.FindStringSubmatch(rest)
+		if m == nil {
+			return time.Time{}, fmt.Errorf("invalid offset '%s' in '%s'", rest, expr)
+		}
+		rest = rest[len(m[0]):]
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return time.Time{}, err
+		}
+		if m[1] == "-" {
+			n = -n
+		}
+		switch m[3] {
+		case "ms":
+			t = t.Add(time.Duration(n) * time.Millisecond)
+		case "s":
+			t = t.Add(time.Duration(n) * time.Second)
+		case "m":
+			t = t.Add(time.Duration(n) * time.Minute)
+		case "h":
+			t = t.Add(time.Duration(n) * time.Hour)
+		case "d":
+			t = t.AddDate(0, 0, n)
+		case "w":
+			t = t.AddDate(0, 0, 7*n)
+		case "M":
+			t = t.AddDate(0, n, 0)
+		case "y":
+			t = t.AddDate(n, 0, 0)
+		}
+	}
+	return t, nil
+}
+
+// InfluxTime formats a time as string literal in InfluxQL.
+func InfluxTime(t time.Time) string {
+	return "'" + t.UTC().Format(time.RFC3339Nano) + "'"
+}
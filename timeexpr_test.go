@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeExpr(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+	// a wednesday
+	now := time.Date(2020, 9, 16, 14, 30, 15, 0, berlin)
+	tests := []struct {
+		expr string
+		t    time.Time
+	}{
+		{"2020-09-01", time.Date(2020, 9, 1, 0, 0, 0, 0, berlin)},
+		{"2020-09-01 12:00", time.Date(2020, 9, 1, 12, 0, 0, 0, berlin)},
+		{"2020-09-01 12:00:30", time.Date(2020, 9, 1, 12, 0, 30, 0, berlin)},
+		{"2020-09-01T12:00:30", time.Date(2020, 9, 1, 12, 0, 30, 0, berlin)},
+		{"2020-09-01T12:00:00Z", time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)},
+		{" 2020-09-01 ", time.Date(2020, 9, 1, 0, 0, 0, 0, berlin)},
+		{"now", now},
+		{"-7d", now.AddDate(0, 0, -7)},
+		{"now-1h+30m", now.Add(-30 * time.Minute)},
+		{"-500ms", now.Add(-500 * time.Millisecond)},
+		{"today", time.Date(2020, 9, 16, 0, 0, 0, 0, berlin)},
+		{"startOfDay+8h", time.Date(2020, 9, 16, 8, 0, 0, 0, berlin)},
+		{"yesterday", time.Date(2020, 9, 15, 0, 0, 0, 0, berlin)},
+		{"startOfWeek", time.Date(2020, 9, 14, 0, 0, 0, 0, berlin)},
+		{"startOfWeek-1w", time.Date(2020, 9, 7, 0, 0, 0, 0, berlin)},
+		{"startOfMonth", time.Date(2020, 9, 1, 0, 0, 0, 0, berlin)},
+		{"startOfMonth-1M", time.Date(2020, 8, 1, 0, 0, 0, 0, berlin)},
+		{"startOfYear+1y", time.Date(2021, 1, 1, 0, 0, 0, 0, berlin)},
+		{"-1M", time.Date(2020, 8, 16, 14, 30, 15, 0, berlin)},
+		{"-90s", now.Add(-90 * time.Second)},
+	}
+	for _, test := range tests {
+		out, err := ParseTimeExpr(test.expr, now)
+		if err != nil {
+			t.Errorf("%s: %s", test.expr, err.Error())
+			continue
+		}
+		if !out.Equal(test.t) {
+			t.Errorf("%s: expected %s, got %s", test.expr, test.t, out)
+		}
+	}
+}
+
+func TestParseTimeExprWeekStart(t *testing.T) {
+	// weeks start on monday, also on sundays
+	sunday := time.Date(2020, 9, 20, 10, 0, 0, 0, time.UTC)
+	monday := time.Date(2020, 9, 14, 0, 0, 0, 0, time.UTC)
+	for _, now := range []time.Time{monday, monday.Add(time.Hour), sunday} {
+		out, err := ParseTimeExpr("startOfWeek", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !out.Equal(monday) {
+			t.Errorf("%s: expected %s, got %s", now.Weekday(), monday, out)
+		}
+	}
+}
+
+func TestParseTimeExprErrors(t *testing.T) {
+	now := time.Date(2020, 9, 16, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "is neither a date nor a relative time"},
+		{"last week", "is neither a date nor a relative time"},
+		{"7d", "is neither a date nor a relative time"},
+		{"2020-13-01", "is neither a date nor a relative time"},
+		{"now-7x", "invalid offset '-7x' in 'now-7x'"},
+		{"-7d+", "invalid offset '+' in '-7d+'"},
+		{"today 8h", "invalid offset ' 8h' in 'today 8h'"},
+	}
+	for _, test := range tests {
+		_, err := ParseTimeExpr(test.expr, now)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error '%s', got %v", test.expr, test.err, err)
+		}
+	}
+}
+
+func TestInfluxTime(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	in := time.Date(2020, 9, 1, 2, 0, 0, 500, berlin)
+	if s := InfluxTime(in); s != "'2020-09-01T00:00:00.0000005Z'" {
+		t.Errorf("unexpected time %s", s)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Problem is an issue found while validating a configuration.
+type Problem struct {
+	Line int
+	Path string
+	Msg  string
+}
+
+func (p Problem) String() string {
+	loc := ""
+	if p.Line > 0 {
+		loc = fmt.Sprintf("line %d: ", p.Line)
+	}
+	if p.Path != "" {
+		return fmt.Sprintf("%s%s: %s", loc, p.Path, p.Msg)
+	}
+	return fmt.Sprintf("%s%s", loc, p.Msg)
+}
+
+type validator struct {
+	lines    map[string]int
+	problems []Problem
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{
+		Line: LineOf(v.lines, path),
+		Path: path,
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+var yamlErrLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// Validate performs static checks on a configuration file without connecting
+// to ElasticSearch or InfluxDB. All problems found are returned, ordered by
+// the line they occur on.
+func Validate(cfgFile string, sets []string) []Problem {
+	v := &validator{lines: map[string]int{}}
+
+	file, err := ioutil.ReadFile(os.ExpandEnv(cfgFile))
+	if err != nil {
+		v.add("", "could not read config file: %s", err.Error())
+		return v.problems
+	}
+	file, err = expandScalarVars(file)
+	if err != nil {
+		v.add("", "%s", err.Error())
+		return v.problems
+	}
+	v.lines = YamlLines(file)
+
+	var strict Config
+	if err := yaml.UnmarshalStrict(file, &strict); err != nil {
+		if te, ok := err.(*yaml.TypeError); ok {
+			for _, e := range te.Errors {
+				if m := yamlErrLine.FindStringSubmatch(e); m != nil {
+					line, _ := strconv.Atoi(m[1])
+					v.problems = append(v.problems, Problem{Line: line, Msg: m[2]})
+				} else {
+					v.add("", "%s", e)
+				}
+			}
+		} else {
+			v.add("", "%s", err.Error())
+			return v.problems
+		}
+	}
+
+	c, err := loadConf(cfgFile, true, sets)
+	if err != nil {
+		v.add("", "%s", err.Error())
+		return v.problems
+	}
+
+	v.validateRegurgitate(c)
+	v.validateIterator(c.Ruminate.Iterator, LangJee, "ruminate.iterator")
+	v.validateGulp(c)
+
+	sort.SliceStable(v.problems, func(a, b int) bool { return v.problems[a].Line < v.problems[b].Line })
+	return v.problems
+}
+
+func (v *validator) validateRegurgitate(c Config) {
+	r := c.Regurgitate
+	switch r.Paging {
+	case PagingNone, PagingSearchAfter, PagingScroll:
+	default:
+		v.add("regurgitate.paging", "paging '%s' is not supported, use '%s' or '%s'", r.Paging, PagingSearchAfter, PagingScroll)
+	}
+	if r.Concurrency < 1 {
+		v.add("regurgitate.concurrency", "must be at least 1")
+	}
+	if r.MaxQps < 0 {
+		v.add("regurgitate.max_qps", "must not be negative")
+	}
+	if r.Timeout < 0 {
+		v.add("regurgitate.timeout", "must not be negative")
+	}
+	if r.Chunk < 0 {
+		v.add("regurgitate.chunk", "must not be negative")
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		v.add("regurgitate.timezone", "%s", err.Error())
+	}
+	if _, err := NewIndexPattern(r.Index, "UTC"); err != nil {
+		v.add("regurgitate.index", "%s", err.Error())
+	}
+
+	s := r.Sampler
+	if s.Interval != "" {
+		if _, err := ParseCron(s.Interval); err != nil {
+			v.add("regurgitate.sampler.interval", "invalid cron spec: %s", err.Error())
+		}
+		if s.Samples > 1 && s.SampleOffset <= 0 {
+			v.add("regurgitate.sampler.sample_offset", "must be greater than zero if more than one sample is taken")
+		}
+	}
+	if s.Offset < 0 {
+		v.add("regurgitate.sampler.offset", "must not be negative")
+	}
+	if s.SampleOffset < 0 {
+		v.add("regurgitate.sampler.sample_offset", "must not be negative")
+	}
+
+	if r.Query == "" {
+		v.add("regurgitate.query", "no query defined")
+		return
+	}
+	qt, err := NewQueryTemplate(c)
+	if err != nil {
+		v.add("regurgitate.query", "%s", err.Error())
+		return
+	}
+	q, err := qt.RenderSample(s)
+	if err != nil {
+		v.add("regurgitate.query", "%s", err.Error())
+		return
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(q.Body), &parsed); err != nil {
+		p := Problem{
+			Line: LineOf(v.lines, "regurgitate.query"),
+			Path: "regurgitate.query",
+			Msg:  fmt.Sprintf("rendered query is not valid JSON: %s", err.Error()),
+		}
+		// the query is usually written as block scalar starting on the line
+		// following the key, which allows to point to the line of the error
+		if se, ok := err.(*json.SyntaxError); ok && p.Line > 0 && se.Offset <= int64(len(q.Body)) {
+			p.Line += 1 + strings.Count(q.Body[:se.Offset], "\n")
+		}
+		v.problems = append(v.problems, p)
+	}
+}
+
+func (v *validator) validateGulp(c Config) {
+	rp := c.Gulp.RetentionPolicy
+	if rp.Name != "" && rp.Replication < 1 {
+		v.add("gulp.retention_policy.replication", "must be at least 1")
+	}
+	names := make(map[string]bool)
+	for n, cq := range c.Gulp.ContinuousQueries {
+		path := fmt.Sprintf("gulp.continuous_queries[%d]", n)
+		if cq.Name == "" {
+			v.add(path+".name", "no name defined")
+		} else if names[cq.Name] {
+			v.add(path+".name", "continuous query '%s' is defined more than once", cq.Name)
+		}
+		names[cq.Name] = true
+		if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(cq.Query)), "SELECT") {
+			v.add(path+".query", "must be a SELECT statement")
+		}
+	}
+}
+
+func (v *validator) validateIterator(i Iterator, lang, path string) {
+	if i.Lang != "" {
+		lang = i.Lang
+		if !isLang(lang) {
+			v.add(path+".lang", "unsupported expression language '%s', must be one of %s", lang, strings.Join(Langs, ", "))
+			return
+		}
+	}
+	if i.Selector == "" {
+		v.add(path+".selector", "no selector defined")
+	} else {
+		v.validateExpr(lang, i.Selector, path+".selector")
+	}
+	if i.Time != "" {
+		v.validateExpr(lang, i.Time, path+".time")
+	}
+	for key, selector := range i.Tags {
+		v.validateExpr(lang, selector, path+".tags."+key)
+	}
+	for key, selector := range i.Values {
+		v.validateExpr(lang, selector, path+".values."+key)
+	}
+	for n, iter := range i.Iterators {
+		v.validateIterator(iter, lang, fmt.Sprintf("%s.iterators[%d]", path, n))
+	}
+}
+
+func (v *validator) validateExpr(lang, expr, path string) {
+	if _, err := CompileExpression(lang, expr); err != nil {
+		v.add(path, "invalid expression '%s': %s", expr, err.Error())
+	}
+}
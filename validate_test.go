@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     string
+		problems []string
+	}{
+		{
+			"valid",
+			`regurgitate:
+  query: '{"size": 0}'
+  sampler:
+    interval: '0 0 * * * *'
+ruminate:
+  iterator:
+    selector: .aggregations
+`,
+			nil,
+		},
+		{
+			"cron",
+			`regurgitate:
+  query: '{"size": 0}'
+  sampler:
+    interval: '0 61 * * * *'
+ruminate:
+  iterator:
+    selector: .aggregations
+`,
+			[]string{"line 4: regurgitate.sampler.interval: invalid cron spec: minute must be between 0 and 59, got 61"},
+		},
+		{
+			"settings",
+			`regurgitate:
+  query: '{"size": 0}'
+  concurrency: 0
+  paging: pages
+ruminate:
+  iterator:
+    selector: .aggregations
+`,
+			[]string{
+				"line 3: regurgitate.concurrency: must be at least 1",
+				"line 4: regurgitate.paging: paging 'pages' is not supported",
+			},
+		},
+		{
+			// type errors prevent further checks
+			"types",
+			`gulp:
+  port: many
+`,
+			[]string{
+				"line 2: cannot unmarshal !!str `many` into int",
+				"error while parsing",
+			},
+		},
+		{
+			"query",
+			`regurgitate:
+  query: |
+    {"size": 0,
+     "aggs": }
+ruminate:
+  iterator:
+    selector: .aggregations
+    iterators:
+      - selector: .hosts.buckets
+        lang: cobol
+`,
+			[]string{
+				"line 4: regurgitate.query: rendered query is not valid JSON",
+				"line 10: ruminate.iterator.iterators[0].lang: unsupported expression language 'cobol'",
+			},
+		},
+		{
+			"unknown key",
+			`regurgitate:
+  query: '{}'
+  querry: '{}'
+ruminate:
+  iterator:
+    selector: .aggregations
+`,
+			[]string{"line 3: field querry not found in type main.RegurgitateConf"},
+		},
+		{
+			"missing selector",
+			`regurgitate:
+  query: '{}'
+`,
+			[]string{"ruminate.iterator.selector: no selector defined"},
+		},
+	}
+	for _, test := range tests {
+		file := writeConf(t, test.conf)
+		problems := Validate(file, nil)
+		os.Remove(file)
+		if len(problems) != len(test.problems) {
+			t.Errorf("%s: expected %d problems, got %v", test.name, len(test.problems), problems)
+			continue
+		}
+		for n, p := range problems {
+			if !strings.Contains(p.String(), test.problems[n]) {
+				t.Errorf("%s: expected problem '%s', got '%s'", test.name, test.problems[n], p)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type yamlFrame struct {
+	indent int
+	path   string
+	item   bool
+	items  int
+}
+
+// YamlLines maps the keys of a YAML document to the lines they are defined
+// on. Keys are written as paths such as 'ruminate.iterator.iterators[0].tags'.
+// Only block style mappings and sequences are considered, which is what
+// configuration files are usually written in.
+func YamlLines(doc []byte) map[string]int {
+	lines := make(map[string]int)
+	stack := []*yamlFrame{{indent: -1}}
+	blockIndent := -1
+
+	scanner := bufio.NewScanner(bytes.NewReader(doc))
+	scanner.Buffer(make([]byte, 64*1024), len(doc)+1)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if blockIndent >= 0 {
+			if indent > blockIndent {
+				continue
+			}
+			blockIndent = -1
+		}
+
+		for strings.HasPrefix(content, "- ") || content == "-" {
+			for len(stack) > 1 {
+				top := stack[len(stack)-1]
+				if top.indent > indent || (top.indent == indent && top.item) {
+					stack = stack[:len(stack)-1]
+					continue
+				}
+				break
+			}
+			parent := stack[len(stack)-1]
+			path := fmt.Sprintf("%s[%d]", parent.path, parent.items)
+			parent.items++
+			lines[path] = n
+			stack = append(stack, &yamlFrame{indent: indent, path: path, item: true})
+
+			rest := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+			indent += len(content) - len(rest)
+			content = rest
+		}
+
+		colon := strings.Index(content, ":")
+		if colon < 0 || content == "" {
+			continue
+		}
+		if colon+1 < len(content) && content[colon+1] != ' ' {
+			continue
+		}
+		key := strings.Trim(strings.TrimSpace(content[:colon]), "\"'")
+		value := strings.TrimSpace(content[colon+1:])
+
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		path := key
+		if parent.path != "" {
+			path = parent.path + "." + key
+		}
+		lines[path] = n
+		stack = append(stack, &yamlFrame{indent: indent, path: path})
+
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			blockIndent = indent
+		}
+	}
+	return lines
+}
+
+// LineOf returns the line the key given is defined on. If the key itself is
+// not found, the line of the closest parent found is returned. Zero is
+// returned if neither is found.
+func LineOf(lines map[string]int, path string) int {
+	for path != "" {
+		if l, ok := lines[path]; ok {
+			return l
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestYamlLines(t *testing.T) {
+	doc := `# comment
+regurgitate:
+  index: logs
+  query: |
+    {"size": 0,
+     "fake: key": 1}
+  nodes:
+    - http://es1:9200
+    - http://es2:9200
+
+ruminate:
+  iterator:
+    selector: aggregations
+    iterators:
+      - selector: hosts.buckets
+        tags:
+          host: key
+      - "selector": status.buckets
+        time: "http://x"
+`
+	expected := map[string]int{
+		"regurgitate":                              2,
+		"regurgitate.index":                        3,
+		"regurgitate.query":                        4,
+		"regurgitate.nodes":                        7,
+		"regurgitate.nodes[0]":                     8,
+		"regurgitate.nodes[1]":                     9,
+		"ruminate":                                 11,
+		"ruminate.iterator":                        12,
+		"ruminate.iterator.selector":               13,
+		"ruminate.iterator.iterators":              14,
+		"ruminate.iterator.iterators[0]":           15,
+		"ruminate.iterator.iterators[0].selector":  15,
+		"ruminate.iterator.iterators[0].tags":      16,
+		"ruminate.iterator.iterators[0].tags.host": 17,
+		"ruminate.iterator.iterators[1]":           18,
+		"ruminate.iterator.iterators[1].selector":  18,
+		"ruminate.iterator.iterators[1].time":      19,
+	}
+	lines := YamlLines([]byte(doc))
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+}
+
+func TestYamlLinesNestedSequences(t *testing.T) {
+	doc := "a:\n- - x\n  - y\n- z: 1\n"
+	expected := map[string]int{"a": 1, "a[0]": 2, "a[0][0]": 2, "a[0][1]": 3, "a[1]": 4, "a[1].z": 4}
+	if lines := YamlLines([]byte(doc)); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+}
+
+func TestLineOf(t *testing.T) {
+	lines := map[string]int{"gulp": 1, "gulp.host": 2, "ruminate.iterator.iterators[0]": 5}
+	tests := []struct {
+		path string
+		line int
+	}{
+		{"gulp.host", 2},
+		{"gulp.port", 1},
+		{"ruminate.iterator.iterators[0].tags.host", 5},
+		{"ruminate.iterator.iterators[1]", 0},
+		{"poop", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if l := LineOf(lines, test.path); l != test.line {
+			t.Errorf("%s: expected line %d, got %d", test.path, test.line, l)
+		}
+	}
+}